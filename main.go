@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"net/smtp"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/chuck21619/planeboard-backend/ws"
@@ -23,6 +24,39 @@ func main() {
 	}
 
 	hub := ws.NewHub()
+	if grace := os.Getenv("RECONNECT_GRACE_SECONDS"); grace != "" {
+		seconds, err := strconv.Atoi(grace)
+		if err != nil {
+			log.Printf("WARNING: invalid RECONNECT_GRACE_SECONDS %q", grace)
+		} else {
+			hub.ReconnectGrace = time.Duration(seconds) * time.Second
+		}
+	}
+	if depth := os.Getenv("UNDO_DEPTH"); depth != "" {
+		undoDepth, err := strconv.Atoi(depth)
+		if err != nil {
+			log.Printf("WARNING: invalid UNDO_DEPTH %q", depth)
+		} else {
+			hub.UndoDepth = undoDepth
+		}
+	}
+	if life := os.Getenv("STARTING_LIFE"); life != "" {
+		startingLife, err := strconv.Atoi(life)
+		if err != nil {
+			log.Printf("WARNING: invalid STARTING_LIFE %q", life)
+		} else {
+			hub.StartingLife = startingLife
+		}
+	}
+
+	if catalogPath := os.Getenv("SCRYFALL_BULK_PATH"); catalogPath != "" {
+		catalog, err := ws.LoadCardCatalog(catalogPath)
+		if err != nil {
+			log.Printf("WARNING: card catalog not loaded: %v", err)
+		} else {
+			ws.SetCardCatalog(catalog)
+		}
+	}
 
 	//metrics
 	if os.Getenv("ENVIRONMENT") == "production" {
@@ -35,6 +69,7 @@ func main() {
 			log.Printf("WARNING: Failed to connect to DB: %v", err)
 		}
 		defer db.Close()
+
 		go func() {
 			ticker := time.NewTicker(1 * time.Hour)
 			defer ticker.Stop()
@@ -46,6 +81,17 @@ func main() {
 				logRoomCountToSupabase(db, roomCount)
 			}
 		}()
+
+		//persistence
+		store, err := ws.NewPostgresStore(db)
+		if err != nil {
+			log.Printf("WARNING: room persistence disabled: %v", err)
+		} else {
+			hub.Store = store
+			if err := hub.LoadRooms(); err != nil {
+				log.Printf("WARNING: failed to restore rooms: %v", err)
+			}
+		}
 	}
 
 	http.HandleFunc("/health", withCORS(func(w http.ResponseWriter, r *http.Request) {
@@ -59,6 +105,18 @@ func main() {
 
 	http.HandleFunc("/report", withCORS(handleReport))
 
+	http.HandleFunc("/rooms/log", withCORS(func(w http.ResponseWriter, r *http.Request) {
+		ws.ServeEventLog(hub, w, r)
+	}))
+
+	http.HandleFunc("/rooms/replay", withCORS(func(w http.ResponseWriter, r *http.Request) {
+		ws.ServeReplay(hub, w, r)
+	}))
+
+	http.HandleFunc("/rooms/audit", withCORS(func(w http.ResponseWriter, r *http.Request) {
+		ws.ServeAudit(hub, w, r)
+	}))
+
 	port := os.Getenv("PORT")
 	log.Printf("Server started on :%s", port)
 	log.Fatal(http.ListenAndServe(":"+port, nil))
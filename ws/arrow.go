@@ -0,0 +1,67 @@
+package ws
+
+import "errors"
+
+// Arrow points from one card, player or spot on the board to another.
+type Arrow struct {
+	ID     string   `json:"id"`
+	Owner  string   `json:"owner"`
+	Source ArrowEnd `json:"source"`
+	Target ArrowEnd `json:"target"`
+	Color  string   `json:"color,omitempty"`
+	// UntilEndOfTurn arrows are cleared when the turn passes.
+	UntilEndOfTurn bool `json:"untilEndOfTurn,omitempty"`
+}
+
+// ArrowEnd is a card, a player, or, when neither is set, a point on the board.
+type ArrowEnd struct {
+	Card   string  `json:"card,omitempty"`
+	Player string  `json:"player,omitempty"`
+	X      float64 `json:"x,omitempty"`
+	Y      float64 `json:"y,omitempty"`
+}
+
+func (r *Room) validArrowEnd(end ArrowEnd) error {
+	if end.Card != "" && end.Player != "" {
+		return errors.New("an arrow end is either a card or a player")
+	}
+	if _, ok := r.Cards[end.Card]; end.Card != "" && !ok {
+		return errors.New("card is not on the board")
+	}
+	if _, ok := r.PlayerPositions[end.Player]; end.Player != "" && !ok {
+		return errors.New("that player is not in this room")
+	}
+	return nil
+}
+
+// addArrow draws an arrow for the player. The caller must hold r.mu.
+func (r *Room) addArrow(username string, arrow Arrow) (*Arrow, error) {
+	if arrow.ID == "" {
+		return nil, errors.New("arrow needs an id")
+	}
+	if _, ok := r.Arrows[arrow.ID]; ok {
+		return nil, errors.New("arrow already exists")
+	}
+	if err := r.validArrowEnd(arrow.Source); err != nil {
+		return nil, err
+	}
+	if err := r.validArrowEnd(arrow.Target); err != nil {
+		return nil, err
+	}
+	arrow.Owner = username
+	r.Arrows[arrow.ID] = &arrow
+	return &arrow, nil
+}
+
+// clearTurnArrows removes the arrows that only last until end of turn and
+// returns their ids. The caller must hold r.mu.
+func (r *Room) clearTurnArrows() []string {
+	var cleared []string
+	for id, arrow := range r.Arrows {
+		if arrow.UntilEndOfTurn {
+			delete(r.Arrows, id)
+			cleared = append(cleared, id)
+		}
+	}
+	return cleared
+}
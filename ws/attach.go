@@ -0,0 +1,93 @@
+package ws
+
+import "errors"
+
+// attachCard attaches an aura, equipment or other card to a host on the
+// board. The caller must hold r.mu.
+func (r *Room) attachCard(cardID string, hostID string) error {
+	card, ok := r.Cards[cardID]
+	if !ok {
+		return errors.New("card is not on the board")
+	}
+	if _, ok := r.Cards[hostID]; !ok {
+		return errors.New("host is not on the board")
+	}
+	for id := hostID; id != ""; id = r.Cards[id].AttachedTo {
+		if id == cardID {
+			return errors.New("a card cannot be attached to itself")
+		}
+	}
+	card.AttachedTo = hostID
+	return nil
+}
+
+// attachments returns the cards attached to the host, and the cards attached
+// to those, and so on.
+func (r *Room) attachments(hostID string) []*BoardCard {
+	var attached []*BoardCard
+	for _, card := range r.Cards {
+		if card.AttachedTo == hostID {
+			attached = append(attached, card)
+			attached = append(attached, r.attachments(card.ID)...)
+		}
+	}
+	return attached
+}
+
+// moveCards moves cards to new positions, carrying along whatever is attached
+// to them unless it is being moved itself. It returns every card that moved.
+// The caller must hold r.mu.
+func (r *Room) moveCards(positions []BoardCard) []*BoardCard {
+	moving := make(map[string]bool, len(positions))
+	for _, position := range positions {
+		moving[position.ID] = true
+	}
+	var moved []*BoardCard
+	for _, position := range positions {
+		card := r.Cards[position.ID]
+		dx, dy := position.X-card.X, position.Y-card.Y
+		card.X = position.X
+		card.Y = position.Y
+		moved = append(moved, card)
+		for _, attached := range r.attachments(card.ID) {
+			if moving[attached.ID] {
+				continue
+			}
+			moving[attached.ID] = true
+			attached.X += dx
+			attached.Y += dy
+			moved = append(moved, attached)
+		}
+	}
+	return moved
+}
+
+// removeFromBoard takes a card off the battlefield. Anything attached to it
+// falls off and stays where it is; clients do the same when a host leaves.
+// Arrows to or from it go with it. The caller must hold r.mu.
+func (r *Room) removeFromBoard(cardID string) {
+	delete(r.Cards, cardID)
+	for _, card := range r.Cards {
+		if card.AttachedTo == cardID {
+			card.AttachedTo = ""
+		}
+	}
+	for id, arrow := range r.Arrows {
+		if arrow.Source.Card == cardID || arrow.Target.Card == cardID {
+			delete(r.Arrows, id)
+		}
+	}
+}
+
+func (r *Room) broadcastMoved(moved []*BoardCard, exclude *Client) {
+	r.BroadcastEachExcept(func(username string) interface{} {
+		cards := make([]*BoardCard, len(moved))
+		for i, card := range moved {
+			cards[i] = boardCardFor(card, username)
+		}
+		return map[string]interface{}{
+			"type":  "CARDS_MOVED",
+			"cards": cards,
+		}
+	}, exclude)
+}
@@ -0,0 +1,136 @@
+package ws
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+)
+
+type SeedAudit struct {
+	SeedEpoch
+	Verified bool `json:"verified"`
+}
+
+type DiceRollAudit struct {
+	DiceRoll
+	Verified bool `json:"verified"`
+}
+
+// ShuffleAudit reports whether a shuffle follows from its seed and whether the
+// library the game went on with is the one the shuffle produced.
+type ShuffleAudit struct {
+	ShuffleRecord
+	Verified       bool `json:"verified"`
+	LibraryMatches bool `json:"libraryMatches"`
+}
+
+type RoomAudit struct {
+	Room     string          `json:"room"`
+	Live     bool            `json:"live"`
+	Seeds    []SeedAudit     `json:"seeds"`
+	Rolls    []DiceRollAudit `json:"diceRolls"`
+	Shuffles []ShuffleAudit  `json:"shuffles"`
+}
+
+// auditRoom replays a room's event log and re-runs every dice roll and shuffle
+// whose seed has been revealed. Library orders stay hidden while the room is
+// live, so its shuffles can only be checked once the game is over.
+func auditRoom(roomID string, events []GameEvent, live bool) (*RoomAudit, error) {
+	entries := make(map[string]json.RawMessage)
+	libraryMatches := make(map[uint64]bool)
+	for _, event := range events {
+		event.Change.applyTo(entries)
+		for key, value := range event.Change.Set {
+			if !strings.HasPrefix(key, "shuffles/") {
+				continue
+			}
+			var shuffle ShuffleRecord
+			var deck Deck
+			if json.Unmarshal(value, &shuffle) != nil || json.Unmarshal(entries["decks/"+shuffle.Deck], &deck) != nil {
+				continue
+			}
+			libraryMatches[shuffle.Nonce] = sameOrder(cardIDs(deck.Cards), shuffle.After)
+		}
+	}
+	state, err := snapshotFromEntries(roomID, entries)
+	if err != nil {
+		return nil, err
+	}
+
+	audit := &RoomAudit{
+		Room:     roomID,
+		Live:     live,
+		Seeds:    []SeedAudit{},
+		Rolls:    []DiceRollAudit{},
+		Shuffles: []ShuffleAudit{},
+	}
+	revealed := make(map[int]string)
+	for _, epoch := range state.Seeds {
+		verified := epoch.Seed != "" && VerifySeed(*epoch)
+		if verified {
+			revealed[epoch.Epoch] = epoch.Seed
+		}
+		audit.Seeds = append(audit.Seeds, SeedAudit{SeedEpoch: *epoch, Verified: verified})
+	}
+	for _, roll := range state.DiceRolls {
+		seed, ok := revealed[roll.Epoch]
+		audit.Rolls = append(audit.Rolls, DiceRollAudit{
+			DiceRoll: roll,
+			Verified: ok && VerifyDiceRoll(seed, roll),
+		})
+	}
+	for _, shuffle := range state.Shuffles {
+		shuffleAudit := ShuffleAudit{ShuffleRecord: shuffle}
+		if !live {
+			seed, ok := revealed[shuffle.Epoch]
+			shuffleAudit.Verified = ok && VerifyShuffle(seed, shuffle)
+			shuffleAudit.LibraryMatches = libraryMatches[shuffle.Nonce]
+		} else {
+			shuffleAudit.Before = nil
+			shuffleAudit.After = nil
+		}
+		audit.Shuffles = append(audit.Shuffles, shuffleAudit)
+	}
+	return audit, nil
+}
+
+func sameOrder(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// ServeAudit re-runs a room's dice rolls and library shuffles from its
+// revealed seeds.
+func ServeAudit(hub *Hub, w http.ResponseWriter, r *http.Request) {
+	roomID := r.URL.Query().Get("room")
+	if roomID == "" {
+		http.Error(w, "Missing room ID", http.StatusBadRequest)
+		return
+	}
+	events, live, err := hub.roomEvents(roomID)
+	if err != nil {
+		log.Printf("error loading events for room %s: %v", roomID, err)
+		http.Error(w, "Failed to load events", http.StatusInternalServerError)
+		return
+	}
+	if len(events) == 0 {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+	audit, err := auditRoom(roomID, events, live)
+	if err != nil {
+		log.Printf("error auditing room %s: %v", roomID, err)
+		http.Error(w, "Failed to audit room", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(audit)
+}
@@ -1,21 +1,45 @@
 package ws
 
 type Card struct {
-	ID           string `json:"id"`
-	Name         string `json:"name"`
-	ImageURL     string `json:"imageUrl"`
-	ImageURLBack string `json:"imageUrlBack"`
-	UID          string `json:"uid"`
-	HasTokens    bool   `json:"hasTokens"`
-	NumFaces     int    `json:"numFaces"`
-	Token        bool   `json:"token"`
+	ID           string     `json:"id"`
+	Name         string     `json:"name"`
+	ImageURL     string     `json:"imageUrl"`
+	ImageURLBack string     `json:"imageUrlBack"`
+	UID          string     `json:"uid"`
+	HasTokens    bool       `json:"hasTokens"`
+	NumFaces     int        `json:"numFaces"`
+	Token        bool       `json:"token"`
+	Hidden       bool       `json:"hidden,omitempty"`
+	Layout       string     `json:"layout,omitempty"`
+	Faces        []CardFace `json:"faces,omitempty"`
+	Tokens       []TokenRef `json:"tokens,omitempty"`
+	// Visibility overrides the visibility of the zone the card is in until
+	// the card changes zones.
+	Visibility *Visibility `json:"visibility,omitempty"`
 }
 
 type BoardCard struct {
 	Card
-	X         float64 `json:"x"`
-	Y         float64 `json:"y"`
-	Owner     string  `json:"owner"`
-	Tapped    bool    `json:"tapped"`
-	FlipIndex int     `json:"flipIndex"`
+	X          float64 `json:"x"`
+	Y          float64 `json:"y"`
+	Owner      string  `json:"owner"`
+	Controller string  `json:"controller"`
+	Tapped     bool    `json:"tapped"`
+	FlipIndex  int     `json:"flipIndex"`
+	FaceDown   bool    `json:"faceDown,omitempty"`
+	AttachedTo string  `json:"attachedTo,omitempty"`
+	// Damage marked on the card this turn.
+	Damage int `json:"damage,omitempty"`
+	// Counters on the card by kind. They are lost when the card leaves the
+	// board.
+	Counters map[string]int `json:"counters,omitempty"`
+}
+
+// controlledBy is the player who controls the card: its owner, unless
+// someone has gained control of it.
+func (c *BoardCard) controlledBy() string {
+	if c.Controller == "" {
+		return c.Owner
+	}
+	return c.Controller
 }
@@ -0,0 +1,225 @@
+package ws
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+type CardFace struct {
+	Name     string `json:"name"`
+	ManaCost string `json:"manaCost,omitempty"`
+	TypeLine string `json:"typeLine,omitempty"`
+	ImageURL string `json:"imageUrl,omitempty"`
+}
+
+// TokenRef identifies a token a card can create by its Scryfall ID.
+type TokenRef struct {
+	ID       string `json:"id"`
+	Name     string `json:"name,omitempty"`
+	ImageURL string `json:"imageUrl,omitempty"`
+}
+
+type CatalogCard struct {
+	ScryfallID      string
+	Name            string
+	Set             string
+	CollectorNumber string
+	Layout          string
+	TypeLine        string
+	ImageURL        string
+	ImageURLBack    string
+	Faces           []CardFace
+	Tokens          []TokenRef
+	preferred       bool
+}
+
+// CardCatalog is an in-memory index over a Scryfall bulk data dump, so card
+// names and printings can be resolved without any network access.
+type CardCatalog struct {
+	byID    map[string]*CatalogCard
+	byName  map[string]*CatalogCard
+	byPrint map[string]*CatalogCard
+}
+
+var cardCatalog *CardCatalog
+
+// SetCardCatalog makes the catalog available to the deck parsers. It must be
+// called before the server starts accepting connections.
+func SetCardCatalog(catalog *CardCatalog) {
+	cardCatalog = catalog
+}
+
+type scryfallImageURIs struct {
+	Normal string `json:"normal"`
+}
+
+type scryfallCard struct {
+	ID              string            `json:"id"`
+	Name            string            `json:"name"`
+	Lang            string            `json:"lang"`
+	Set             string            `json:"set"`
+	CollectorNumber string            `json:"collector_number"`
+	Layout          string            `json:"layout"`
+	ManaCost        string            `json:"mana_cost"`
+	TypeLine        string            `json:"type_line"`
+	Digital         bool              `json:"digital"`
+	ImageURIs       scryfallImageURIs `json:"image_uris"`
+	CardFaces       []struct {
+		Name      string            `json:"name"`
+		ManaCost  string            `json:"mana_cost"`
+		TypeLine  string            `json:"type_line"`
+		ImageURIs scryfallImageURIs `json:"image_uris"`
+	} `json:"card_faces"`
+	AllParts []struct {
+		ID        string `json:"id"`
+		Component string `json:"component"`
+		Name      string `json:"name"`
+	} `json:"all_parts"`
+}
+
+// LoadCardCatalog reads a Scryfall bulk data file (a JSON array of card
+// objects, such as "default_cards" or "oracle_cards") one card at a time.
+func LoadCardCatalog(path string) (*CardCatalog, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open card catalog: %w", err)
+	}
+	defer file.Close()
+
+	catalog := &CardCatalog{
+		byID:    make(map[string]*CatalogCard),
+		byName:  make(map[string]*CatalogCard),
+		byPrint: make(map[string]*CatalogCard),
+	}
+	decoder := json.NewDecoder(file)
+	if _, err := decoder.Token(); err != nil {
+		return nil, fmt.Errorf("failed to read card catalog: %w", err)
+	}
+	for decoder.More() {
+		var raw scryfallCard
+		if err := decoder.Decode(&raw); err != nil {
+			return nil, fmt.Errorf("failed to read card catalog: %w", err)
+		}
+		catalog.add(newCatalogCard(raw), raw.Lang == "en" && !raw.Digital)
+	}
+	return catalog, nil
+}
+
+func newCatalogCard(raw scryfallCard) *CatalogCard {
+	card := &CatalogCard{
+		ScryfallID:      raw.ID,
+		Name:            raw.Name,
+		Set:             raw.Set,
+		CollectorNumber: raw.CollectorNumber,
+		Layout:          raw.Layout,
+		TypeLine:        raw.TypeLine,
+		ImageURL:        raw.ImageURIs.Normal,
+	}
+	for _, face := range raw.CardFaces {
+		card.Faces = append(card.Faces, CardFace{
+			Name:     face.Name,
+			ManaCost: face.ManaCost,
+			TypeLine: face.TypeLine,
+			ImageURL: face.ImageURIs.Normal,
+		})
+	}
+	// double-faced cards have their images on the faces instead
+	if card.ImageURL == "" && len(card.Faces) > 0 {
+		card.ImageURL = card.Faces[0].ImageURL
+	}
+	if nonStandardBackLayouts[card.Layout] && len(card.Faces) > 1 {
+		card.ImageURLBack = card.Faces[1].ImageURL
+	}
+	for _, part := range raw.AllParts {
+		if part.Component == "token" {
+			card.Tokens = append(card.Tokens, TokenRef{
+				ID:       part.ID,
+				Name:     part.Name,
+				ImageURL: fmt.Sprintf("https://api.scryfall.com/cards/%s?format=image&version=normal", part.ID),
+			})
+		}
+	}
+	return card
+}
+
+// add indexes a card. Names and printings resolve to the first preferred
+// printing seen, so English paper printings win over foreign or digital-only
+// ones that share a set and collector number.
+func (c *CardCatalog) add(card *CatalogCard, preferred bool) {
+	card.preferred = preferred
+	c.byID[card.ScryfallID] = card
+	printing := printKey(card.Set, card.CollectorNumber)
+	if existing, ok := c.byPrint[printing]; !ok || (preferred && !existing.preferred) {
+		c.byPrint[printing] = card
+	}
+	names := []string{card.Name}
+	if front, _, ok := strings.Cut(card.Name, " // "); ok {
+		names = append(names, front)
+	}
+	for _, name := range names {
+		key := nameKey(name)
+		if existing, ok := c.byName[key]; !ok || (preferred && !existing.preferred) {
+			c.byName[key] = card
+		}
+	}
+}
+
+func nameKey(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+func printKey(set, collectorNumber string) string {
+	return strings.ToLower(set) + "/" + strings.ToLower(collectorNumber)
+}
+
+func (c *CardCatalog) ByID(id string) (*CatalogCard, bool) {
+	card, ok := c.byID[id]
+	return card, ok
+}
+
+func (c *CardCatalog) ByName(name string) (*CatalogCard, bool) {
+	card, ok := c.byName[nameKey(name)]
+	return card, ok
+}
+
+func (c *CardCatalog) ByPrint(set, collectorNumber string) (*CatalogCard, bool) {
+	card, ok := c.byPrint[printKey(set, collectorNumber)]
+	return card, ok
+}
+
+// Resolve finds a printing by set and collector number, falling back to the
+// card name when the printing is unknown.
+func (c *CardCatalog) Resolve(name, set, collectorNumber string) (*CatalogCard, bool) {
+	if set != "" && collectorNumber != "" {
+		if card, ok := c.ByPrint(set, collectorNumber); ok {
+			return card, true
+		}
+	}
+	return c.ByName(name)
+}
+
+// NewCard creates a new deck card, with its own ID, for this printing.
+func (card *CatalogCard) NewCard() (Card, error) {
+	id, err := newCardID()
+	if err != nil {
+		return Card{}, err
+	}
+	numFaces := 2
+	if card.ImageURLBack != "" {
+		numFaces = 3
+	}
+	return Card{
+		ID:           id,
+		Name:         card.Name,
+		ImageURL:     card.ImageURL,
+		ImageURLBack: card.ImageURLBack,
+		UID:          card.ScryfallID,
+		HasTokens:    len(card.Tokens) > 0,
+		NumFaces:     numFaces,
+		Layout:       card.Layout,
+		Faces:        card.Faces,
+		Tokens:       card.Tokens,
+	}, nil
+}
@@ -4,29 +4,51 @@ import (
 	"encoding/json"
 	"github.com/gorilla/websocket"
 	"log"
-	mrand "math/rand"
+	"maps"
 	"sync"
 	"time"
 )
 
 type Client struct {
-	Conn      *websocket.Conn
-	Send      chan []byte
-	Room      *Room
-	Username  string
-	Spectator bool
-	DeckUrl   string
-	closeOnce sync.Once
+	Conn        *websocket.Conn
+	Send        chan []byte
+	Room        *Room
+	Username    string
+	Spectator   bool
+	DeckUrl     string
+	DeckList    string
+	ResumeToken string
+	closeOnce   sync.Once
 }
 
+// close hangs up and hands the client to the room to unregister. It never
+// waits for the room: broadcasts call it while holding r.mu, and the room
+// may be waiting for that lock itself. Send is left open, since broadcasts
+// may still be addressing the client; the write loop is told to stop
+// instead.
 func (c *Client) close() {
 	c.closeOnce.Do(func() {
-		c.Room.Unregister <- c
 		c.Conn.Close()
-		close(c.Send)
+		select {
+		case c.Send <- nil:
+		default:
+		}
+		go func() {
+			select {
+			case c.Room.Unregister <- c:
+			case <-c.Room.done:
+			}
+		}()
 	})
 }
 
+// reject turns away a connection the room will not register. The write loop
+// sends the error and then hangs up.
+func (c *Client) reject(reason string) {
+	c.sendError(reason)
+	c.Room.deliver(delivery{client: c})
+}
+
 func (c *Client) read() {
 	defer func() {
 		c.close()
@@ -49,666 +71,1221 @@ func (c *Client) read() {
 			continue
 		}
 
-		switch msg.Type {
-		case "DRAW_CARD":
-			deck, ok := c.Room.Decks[c.Username]
-			if !ok || len(deck.Cards) == 0 {
-				return
-			}
-			deck.Cards = deck.Cards[1:]
-			c.Room.HandSizes[c.Username] += 1
-			update := map[string]interface{}{
-				"type":     "PLAYER_DREW_CARD",
-				"player":   c.Username,
-				"handSize": c.Room.HandSizes[c.Username],
-			}
-			broadcast, _ := json.Marshal(update)
-			c.Room.BroadcastExcept(broadcast, c)
+		touched := func() []string {
+			return c.Room.touchedEntries(msg)
+		}
+		event, revert := c.Room.recordAction(c.Username, msg.Type, rawMsg, touched, func() {
+			c.handle(msg)
+		})
+		if event == nil {
+			continue
+		}
+		if msg.Type != "UNDO" {
+			c.Room.pushUndo(c.Username, event, revert)
+		}
+		if !dragActions[msg.Type] {
+			c.Room.requestSave()
+		}
+	}
+}
+
+// dragActions are sent over and over while something is being dragged. They
+// are logged like any other action, but saving them is left to the room's
+// periodic save.
+var dragActions = map[string]bool{
+	"MOVE_CARD":        true,
+	"MOVE_CARDS":       true,
+	"MOVE_COUNTER":     true,
+	"MOVE_DICE_ROLLER": true,
+}
+
+func (c *Client) handle(msg Message) {
+	c.Room.mu.Lock()
+	err := c.Room.authorize(c, msg)
+	c.Room.mu.Unlock()
+	if err != nil {
+		c.refuse(msg.Type, err)
+		return
+	}
 
-		case "PASS_TURN":
-			c.Room.mu.Lock()
-			c.Room.Turn = getNextTurn(c.Room.PlayerPositions, c.Room.Turn)
+	switch msg.Type {
+	case "DRAW_CARD":
+		c.Room.mu.Lock()
+		card, err := c.Room.drawCard(c.Username)
+		if err == errEmptyLibrary {
+			c.Room.eliminate(c.Username, LossEmptyLibrary)
 			c.Room.mu.Unlock()
-			update := map[string]interface{}{
-				"type": "TURN_PASSED",
-				"turn": c.Room.Turn,
-			}
-			broadcast, _ := json.Marshal(update)
-			c.Room.BroadcastSafe(broadcast)
+			c.Room.announceEliminations([]Elimination{{Player: c.Username, Reason: LossEmptyLibrary}})
+			return
+		}
+		c.Room.mu.Unlock()
+		if err != nil {
+			return
+		}
+		c.Room.announceDraw(c.Username, card)
+
+	case "PASS_TURN":
+		c.Room.mu.Lock()
+		events := c.Room.nextTurn()
+		c.Room.mu.Unlock()
+		c.Room.announceTurn(events)
+
+	case "ADVANCE_PHASE":
+		c.Room.mu.Lock()
+		events := c.Room.advanceStep()
+		c.Room.mu.Unlock()
+		c.Room.announceTurn(events)
+
+	case "SET_PHASE":
+		c.Room.mu.Lock()
+		events := c.Room.enterStep(msg.Step)
+		c.Room.mu.Unlock()
+		c.Room.announceTurn(events)
+
+	case "DECLARE_ATTACKERS":
+		c.Room.mu.Lock()
+		tapped, err := c.Room.declareAttackers(c.Username, msg.Attacks)
+		state := c.Room.combatState()
+		c.Room.mu.Unlock()
+		if err != nil {
+			c.sendError(err.Error())
+			return
+		}
+		state["tapped"] = tapped
+		broadcast, _ := json.Marshal(state)
+		c.Room.BroadcastSafe(broadcast)
+
+	case "DECLARE_BLOCKERS":
+		c.Room.mu.Lock()
+		err := c.Room.declareBlockers(c.Username, msg.Blocks)
+		state := c.Room.combatState()
+		c.Room.mu.Unlock()
+		if err != nil {
+			c.sendError(err.Error())
+			return
+		}
+		broadcast, _ := json.Marshal(state)
+		c.Room.BroadcastSafe(broadcast)
 
-		case "UNTAP_ALL":
-			c.Room.mu.Lock()
-			for _, card := range c.Room.Cards {
-				if card.Owner == c.Username {
-					card.Tapped = false
+	case "ASSIGN_DAMAGE":
+		c.Room.mu.Lock()
+		if err := c.Room.assignDamage(c.Username, msg.Damage); err != nil {
+			c.Room.mu.Unlock()
+			c.sendError(err.Error())
+			return
+		}
+		damaged := make(map[string]interface{})
+		var players []string
+		for _, assignment := range msg.Damage {
+			if assignment.Player != "" {
+				players = append(players, assignment.Player)
+			}
+			if card, ok := c.Room.Cards[assignment.Card]; ok {
+				damaged[card.ID] = map[string]interface{}{
+					"damage":   card.Damage,
+					"counters": card.Counters,
 				}
 			}
+		}
+		// marshal while locked: the totals are the room's own maps
+		update, _ := json.Marshal(map[string]interface{}{
+			"type":            "COMBAT_DAMAGE",
+			"player":          c.Username,
+			"damage":          msg.Damage,
+			"cards":           damaged,
+			"lifeTotals":      c.Room.LifeTotals,
+			"commanderDamage": c.Room.CommanderDamage,
+		})
+		state, _ := json.Marshal(c.Room.combatState())
+		eliminations := c.Room.checkLosses(players)
+		c.Room.mu.Unlock()
+		c.Room.BroadcastSafe(update)
+		c.Room.BroadcastSafe(state)
+		c.Room.announceEliminations(eliminations)
+
+	case "SET_TURN_OPTIONS", "SET_AUTO_YIELD":
+		c.Room.mu.Lock()
+		options := c.Room.TurnOptions[c.Username]
+		if msg.Type == "SET_TURN_OPTIONS" {
+			options.AutoUntap = msg.AutoUntap
+			options.AutoDraw = msg.AutoDraw
+		} else {
+			options.AutoYield = msg.Steps
+		}
+		c.Room.TurnOptions[c.Username] = options
+		c.Room.mu.Unlock()
+		c.sendJSON(map[string]interface{}{
+			"type":    "TURN_OPTIONS_UPDATED",
+			"options": options,
+		})
+
+	case "UNTAP_ALL":
+		c.Room.mu.Lock()
+		c.Room.untapAll(c.Username)
+		c.Room.mu.Unlock()
+		update := map[string]interface{}{
+			"type":   "UNTAPPED_ALL",
+			"player": c.Username,
+		}
+		broadcast, _ := json.Marshal(update)
+		c.Room.BroadcastExcept(broadcast, c)
+
+	case "CARD_TO_TOP_OF_DECK":
+		c.Room.mu.Lock()
+		deck := c.Room.Decks[msg.Username]
+		var card Card
+		if msg.Source == "board" {
+			card, _ = c.Room.takeCard(msg.Username, ZoneBoard, msg.Card.ID)
+		} else if msg.Source == "hand" {
+			handCard, err := c.Room.takeCard(msg.Username, ZoneHand, msg.Card.ID)
+			if err != nil {
+				c.Room.mu.Unlock()
+				c.sendError("Card is not in hand")
+				return
+			}
+			card = handCard
+		} else {
 			c.Room.mu.Unlock()
-			update := map[string]interface{}{
-				"type":   "UNTAPPED_ALL",
-				"player": c.Username,
+			return
+		}
+		deck.putOnTop(card, knownFrom(msg.Source))
+		c.Room.mu.Unlock()
+		c.Room.BroadcastEachExcept(func(username string) interface{} {
+			return map[string]interface{}{
+				"username": c.Username,
+				"type":     "CARD_TO_TOP_OF_DECK",
+				"deckId":   msg.Username,
+				"deck":     c.Room.libraryFor(msg.Username, username),
+				"handSize": c.Room.handSizes(),
+				"id":       msg.Card.ID,
+				"source":   msg.Source,
 			}
-			broadcast, _ := json.Marshal(update)
-			c.Room.BroadcastExcept(broadcast, c)
+		}, c)
 
-		case "CARD_TO_TOP_OF_DECK":
-			c.Room.mu.Lock()
-			deck := c.Room.Decks[msg.Username]
-			if msg.Source == "board" {
-				delete(c.Room.Cards, msg.Card.ID)
-			} else if msg.Source == "hand" {
-				c.Room.HandSizes[msg.Username] -= 1
-			} else {
+	case "CARDS_TO_TOP_OF_DECK":
+		c.Room.mu.Lock()
+		deck := c.Room.Decks[msg.Username]
+		for _, card := range msg.Cards {
+			if msg.Source != "board" {
 				continue
 			}
-			card := Card{
-				ID:           msg.Card.ID,
-				Name:         msg.Card.Name,
-				ImageURL:     msg.Card.ImageURL,
-				ImageURLBack: msg.Card.ImageURLBack,
-				UID:          msg.Card.UID,
-				HasTokens:    msg.Card.HasTokens,
-				NumFaces:     msg.Card.NumFaces,
-				Token:        msg.Card.Token,
-			}
-			deck.Cards = append([]Card{card}, deck.Cards...)
-			c.Room.mu.Unlock()
-			update := map[string]interface{}{
-				"username":  c.Username,
-				"type":      "CARD_TO_TOP_OF_DECK",
-				"deckId":    msg.Username,
-				"deckCards": deck.Cards,
-				"handSize":  c.Room.HandSizes,
-				"id":        msg.Card.ID,
-				"source":    msg.Source,
-			}
-			broadcast, _ := json.Marshal(update)
-			c.Room.BroadcastExcept(broadcast, c)
-
-		case "CARDS_TO_TOP_OF_DECK":
-			c.Room.mu.Lock()
-			deck := c.Room.Decks[msg.Username]
-			for _, card := range msg.Cards {
-				if msg.Source == "board" {
-					delete(c.Room.Cards, card.ID)
-				} else {
-					continue
-				}
-				deckCard := Card{
-					ID:           card.ID,
-					Name:         card.Name,
-					ImageURL:     card.ImageURL,
-					ImageURLBack: card.ImageURLBack,
-					UID:          card.UID,
-					HasTokens:    card.HasTokens,
-					NumFaces:     card.NumFaces,
-					Token:        card.Token,
-				}
-				deck.Cards = append([]Card{deckCard}, deck.Cards...)
+			deckCard, _ := c.Room.takeCard(msg.Username, ZoneBoard, card.ID)
+			deck.putOnTop(deckCard, KnownPublic)
+		}
+		c.Room.mu.Unlock()
+		c.Room.BroadcastEachExcept(func(username string) interface{} {
+			return map[string]interface{}{
+				"username": c.Username,
+				"type":     "CARDS_TO_TOP_OF_DECK",
+				"deckId":   msg.Username,
+				"deck":     c.Room.libraryFor(msg.Username, username),
+				"handSize": c.Room.handSizes(),
+				"ids":      getCardIDs(msg.Cards),
+				"source":   msg.Source,
 			}
-			c.Room.mu.Unlock()
-			update := map[string]interface{}{
-				"username":  c.Username,
-				"type":      "CARDS_TO_TOP_OF_DECK",
-				"deckId":    msg.Username,
-				"deckCards": deck.Cards,
-				"handSize":  c.Room.HandSizes,
-				"ids":       getCardIDs(msg.Cards),
-				"source":    msg.Source,
-			}
-			broadcast, _ := json.Marshal(update)
-			c.Room.BroadcastExcept(broadcast, c)
-
-		case "CARD_TO_BOTTOM_OF_DECK":
-			c.Room.mu.Lock()
-			deck := c.Room.Decks[msg.Username]
-			if msg.Source == "board" {
-				delete(c.Room.Cards, msg.Card.ID)
-			} else if msg.Source == "hand" {
-				c.Room.HandSizes[msg.Username] -= 1
-			} else {
+		}, c)
+
+	case "CARD_TO_BOTTOM_OF_DECK":
+		c.Room.mu.Lock()
+		deck := c.Room.Decks[msg.Username]
+		var card Card
+		if msg.Source == "board" {
+			card, _ = c.Room.takeCard(msg.Username, ZoneBoard, msg.Card.ID)
+		} else if msg.Source == "hand" {
+			handCard, err := c.Room.takeCard(msg.Username, ZoneHand, msg.Card.ID)
+			if err != nil {
+				c.Room.mu.Unlock()
+				c.sendError("Card is not in hand")
 				return
 			}
-			card := Card{
-				ID:           msg.Card.ID,
-				Name:         msg.Card.Name,
-				ImageURL:     msg.Card.ImageURL,
-				ImageURLBack: msg.Card.ImageURLBack,
-				UID:          msg.Card.UID,
-				HasTokens:    msg.Card.HasTokens,
-				NumFaces:     msg.Card.NumFaces,
-				Token:        msg.Card.Token,
-			}
-			deck.Cards = append(deck.Cards, card)
+			card = handCard
+		} else {
 			c.Room.mu.Unlock()
-			update := map[string]interface{}{
-				"username":  c.Username,
-				"type":      "CARD_TO_BOTTOM_OF_DECK",
-				"deckId":    msg.Username,
-				"deckCards": deck.Cards,
-				"handSize":  c.Room.HandSizes,
-				"id":        msg.Card.ID,
-				"source":    msg.Source,
-			}
-			broadcast, _ := json.Marshal(update)
-			c.Room.BroadcastExcept(broadcast, c)
-
-		case "CARDS_TO_BOTTOM_OF_DECK":
-			c.Room.mu.Lock()
-			deck := c.Room.Decks[msg.Username]
-			for _, card := range msg.Cards {
-				if msg.Source == "board" {
-					delete(c.Room.Cards, card.ID)
-				} else {
-					continue
-				}
-				deckCard := Card{
-					ID:           card.ID,
-					Name:         card.Name,
-					ImageURL:     card.ImageURL,
-					ImageURLBack: card.ImageURLBack,
-					UID:          card.UID,
-					HasTokens:    card.HasTokens,
-					NumFaces:     card.NumFaces,
-					Token:        card.Token,
-				}
-				deck.Cards = append(deck.Cards, deckCard)
+			return
+		}
+		deck.putOnBottom(card, knownFrom(msg.Source))
+		c.Room.mu.Unlock()
+		c.Room.BroadcastEachExcept(func(username string) interface{} {
+			return map[string]interface{}{
+				"username": c.Username,
+				"type":     "CARD_TO_BOTTOM_OF_DECK",
+				"deckId":   msg.Username,
+				"deck":     c.Room.libraryFor(msg.Username, username),
+				"handSize": c.Room.handSizes(),
+				"id":       msg.Card.ID,
+				"source":   msg.Source,
 			}
-			c.Room.mu.Unlock()
-			update := map[string]interface{}{
-				"username":  c.Username,
-				"type":      "CARDS_TO_BOTTOM_OF_DECK",
-				"deckId":    msg.Username,
-				"deckCards": deck.Cards,
-				"handSize":  c.Room.HandSizes,
-				"ids":       getCardIDs(msg.Cards),
-				"source":    msg.Source,
-			}
-			broadcast, _ := json.Marshal(update)
-			c.Room.BroadcastExcept(broadcast, c)
-
-		case "CARD_TO_SHUFFLE_IN_DECK":
-			c.Room.mu.Lock()
-			deck := c.Room.Decks[msg.Username]
-			if msg.Source == "board" {
-				delete(c.Room.Cards, msg.Card.ID)
-			} else if msg.Source == "hand" {
-				c.Room.HandSizes[msg.Username] -= 1
-			} else {
+		}, c)
+
+	case "CARDS_TO_BOTTOM_OF_DECK":
+		c.Room.mu.Lock()
+		deck := c.Room.Decks[msg.Username]
+		for _, card := range msg.Cards {
+			if msg.Source != "board" {
+				continue
+			}
+			deckCard, _ := c.Room.takeCard(msg.Username, ZoneBoard, card.ID)
+			deck.putOnBottom(deckCard, KnownPublic)
+		}
+		c.Room.mu.Unlock()
+		c.Room.BroadcastEachExcept(func(username string) interface{} {
+			return map[string]interface{}{
+				"username": c.Username,
+				"type":     "CARDS_TO_BOTTOM_OF_DECK",
+				"deckId":   msg.Username,
+				"deck":     c.Room.libraryFor(msg.Username, username),
+				"handSize": c.Room.handSizes(),
+				"ids":      getCardIDs(msg.Cards),
+				"source":   msg.Source,
+			}
+		}, c)
+
+	case "CARD_TO_SHUFFLE_IN_DECK":
+		c.Room.mu.Lock()
+		deck := c.Room.Decks[msg.Username]
+		var card Card
+		if msg.Source == "board" {
+			card, _ = c.Room.takeCard(msg.Username, ZoneBoard, msg.Card.ID)
+		} else if msg.Source == "hand" {
+			handCard, err := c.Room.takeCard(msg.Username, ZoneHand, msg.Card.ID)
+			if err != nil {
+				c.Room.mu.Unlock()
+				c.sendError("Card is not in hand")
 				return
 			}
-			card := Card{
-				ID:           msg.Card.ID,
-				Name:         msg.Card.Name,
-				ImageURL:     msg.Card.ImageURL,
-				ImageURLBack: msg.Card.ImageURLBack,
-				UID:          msg.Card.UID,
-				HasTokens:    msg.Card.HasTokens,
-				NumFaces:     msg.Card.NumFaces,
-				Token:        msg.Card.Token,
-			}
-			deck.Cards = append(deck.Cards, card)
-			r := mrand.New(mrand.NewSource(time.Now().UnixNano()))
-			r.Shuffle(len(deck.Cards), func(i, j int) {
-				deck.Cards[i], deck.Cards[j] = deck.Cards[j], deck.Cards[i]
-			})
+			card = handCard
+		} else {
 			c.Room.mu.Unlock()
-			update := map[string]interface{}{
-				"username":  c.Username,
-				"type":      "CARD_TO_SHUFFLE_IN_DECK",
-				"deckId":    msg.Username,
-				"deckCards": deck.Cards,
-				"handSize":  c.Room.HandSizes,
-				"id":        msg.Card.ID,
-				"source":    msg.Source,
-			}
-			broadcast, _ := json.Marshal(update)
-			c.Room.BroadcastSafe(broadcast)
-
-		case "CARDS_TO_SHUFFLE_IN_DECK":
-			c.Room.mu.Lock()
-			deck := c.Room.Decks[msg.Username]
-			for _, card := range msg.Cards {
-				if msg.Source == "board" {
-					delete(c.Room.Cards, card.ID)
-				} else {
-					continue
-				}
-				deckCard := Card{
-					ID:           card.ID,
-					Name:         card.Name,
-					ImageURL:     card.ImageURL,
-					ImageURLBack: card.ImageURLBack,
-					UID:          card.UID,
-					HasTokens:    card.HasTokens,
-					NumFaces:     card.NumFaces,
-					Token:        card.Token,
-				}
-				deck.Cards = append(deck.Cards, deckCard)
+			return
+		}
+		deck.putOnBottom(card, "")
+		c.Room.shuffleLibrary(msg.Username)
+		c.Room.mu.Unlock()
+		c.Room.BroadcastEach(func(username string) interface{} {
+			return map[string]interface{}{
+				"username": c.Username,
+				"type":     "CARD_TO_SHUFFLE_IN_DECK",
+				"deckId":   msg.Username,
+				"deck":     c.Room.libraryFor(msg.Username, username),
+				"handSize": c.Room.handSizes(),
+				"id":       msg.Card.ID,
+				"source":   msg.Source,
 			}
-			r := mrand.New(mrand.NewSource(time.Now().UnixNano()))
-			r.Shuffle(len(deck.Cards), func(i, j int) {
-				deck.Cards[i], deck.Cards[j] = deck.Cards[j], deck.Cards[i]
-			})
-			c.Room.mu.Unlock()
-			update := map[string]interface{}{
-				"username":  c.Username,
-				"type":      "CARDS_TO_SHUFFLE_IN_DECK",
-				"deckId":    msg.Username,
-				"deckCards": deck.Cards,
-				"handSize":  c.Room.HandSizes,
-				"ids":       getCardIDs(msg.Cards),
-				"source":    msg.Source,
-			}
-			broadcast, _ := json.Marshal(update)
-			c.Room.BroadcastExcept(broadcast, c)
-
-		case "CARD_PLAYED_FROM_HAND":
-			c.Room.mu.Lock()
-			card := &BoardCard{
-				Card: Card{
-					ID:           msg.Card.ID,
-					Name:         msg.Card.Name,
-					ImageURL:     msg.Card.ImageURL,
-					ImageURLBack: msg.Card.ImageURLBack,
-					UID:          msg.Card.UID,
-					HasTokens:    msg.Card.HasTokens,
-					NumFaces:     msg.Card.NumFaces,
-					Token:        msg.Card.Token,
-				},
-				X:         msg.Card.X,
-				Y:         msg.Card.Y,
-				Owner:     c.Username,
-				Tapped:    false,
-				FlipIndex: msg.Card.FlipIndex,
-			}
-			c.Room.Cards[card.ID] = card
-			c.Room.HandSizes[c.Username] -= 1
-			handSize := c.Room.HandSizes[c.Username]
+		})
+
+	case "CARDS_TO_SHUFFLE_IN_DECK":
+		c.Room.mu.Lock()
+		deck := c.Room.Decks[msg.Username]
+		for _, card := range msg.Cards {
+			if msg.Source != "board" {
+				continue
+			}
+			deckCard, _ := c.Room.takeCard(msg.Username, ZoneBoard, card.ID)
+			deck.putOnBottom(deckCard, "")
+		}
+		c.Room.shuffleLibrary(msg.Username)
+		c.Room.mu.Unlock()
+		c.Room.BroadcastEach(func(username string) interface{} {
+			return map[string]interface{}{
+				"username": c.Username,
+				"type":     "CARDS_TO_SHUFFLE_IN_DECK",
+				"deckId":   msg.Username,
+				"deck":     c.Room.libraryFor(msg.Username, username),
+				"handSize": c.Room.handSizes(),
+				"ids":      getCardIDs(msg.Cards),
+				"source":   msg.Source,
+			}
+		})
+
+	case "CARD_PLAYED_FROM_HAND":
+		c.Room.mu.Lock()
+		handCard, err := c.Room.takeCard(c.Username, ZoneHand, msg.Card.ID)
+		if err != nil {
 			c.Room.mu.Unlock()
-			broadcast := map[string]interface{}{
+			c.sendError("Card is not in hand")
+			return
+		}
+		card := &BoardCard{
+			Card:       handCard,
+			X:          msg.Card.X,
+			Y:          msg.Card.Y,
+			Owner:      c.Username,
+			Controller: c.Username,
+			Tapped:     false,
+			FlipIndex:  msg.Card.FlipIndex,
+		}
+		if msg.Card.FaceDown {
+			card.setFaceDown(true)
+		}
+		c.Room.Cards[card.ID] = card
+		handSize := len(c.Room.Hands[c.Username])
+		c.Room.mu.Unlock()
+		c.Room.BroadcastEachExcept(func(username string) interface{} {
+			return map[string]interface{}{
 				"type":     "CARD_PLAYED_FROM_HAND",
-				"card":     card,
+				"card":     boardCardFor(card, username),
 				"player":   c.Username,
 				"handSize": handSize,
 			}
-			data, _ := json.Marshal(broadcast)
-			c.Room.BroadcastExcept(data, c)
+		}, c)
 
-		case "LIFE_TOTAL_CHANGE":
-			c.Room.mu.Lock()
-			c.Room.LifeTotals[msg.Username] = *msg.LifeTotal
-			c.Room.mu.Unlock()
-			broadcast := map[string]interface{}{
-				"type":      "LIFE_TOTAL_UPDATED",
-				"username":  msg.Username,
-				"lifeTotal": *msg.LifeTotal,
-			}
-			data, _ := json.Marshal(broadcast)
-			c.Room.BroadcastExcept(data, c)
+	case "LIFE_TOTAL_CHANGE":
+		if msg.LifeTotal == nil {
+			c.sendError("Missing life total")
+			return
+		}
+		c.Room.mu.Lock()
+		c.Room.LifeTotals[msg.Username] = *msg.LifeTotal
+		eliminations := c.Room.checkLosses([]string{msg.Username})
+		c.Room.mu.Unlock()
+		broadcast := map[string]interface{}{
+			"type":      "LIFE_TOTAL_UPDATED",
+			"username":  msg.Username,
+			"lifeTotal": *msg.LifeTotal,
+		}
+		data, _ := json.Marshal(broadcast)
+		c.Room.BroadcastExcept(data, c)
+		c.Room.announceEliminations(eliminations)
 
-		case "SPAWN_TOKEN":
-			c.Room.mu.Lock()
-			token := &BoardCard{
-				Card: Card{
-					ID:        msg.Card.ID,
-					Name:      msg.Card.Name,
-					ImageURL:  msg.Card.ImageURL,
-					UID:       msg.Card.UID,
-					HasTokens: msg.Card.HasTokens,
-					NumFaces:  msg.Card.NumFaces,
-					Token:     true,
-				},
-				X:         msg.Card.X,
-				Y:         msg.Card.Y,
-				Owner:     msg.Card.Owner,
-				Tapped:    false,
-				FlipIndex: 0,
-			}
-			c.Room.Cards[token.ID] = token
-			c.Room.mu.Unlock()
-			broadcast := map[string]interface{}{
-				"type":  "SPAWN_TOKEN",
-				"token": token,
-			}
-			data, _ := json.Marshal(broadcast)
-			c.Room.BroadcastExcept(data, c)
+	case "ADD_PLAYER_RESOURCE", "SET_PLAYER_RESOURCE", "ADD_COMMANDER_DAMAGE", "SET_COMMANDER_DAMAGE", "SET_DESIGNATION":
+		c.Room.mu.Lock()
+		var err error
+		switch msg.Type {
+		case "ADD_PLAYER_RESOURCE":
+			err = c.Room.setResource(msg.Username, msg.Kind, c.Room.Resources[msg.Username][msg.Kind]+msg.Count)
+		case "SET_PLAYER_RESOURCE":
+			err = c.Room.setResource(msg.Username, msg.Kind, msg.Count)
+		case "ADD_COMMANDER_DAMAGE":
+			err = c.Room.setCommanderDamage(msg.Username, msg.ID, c.Room.CommanderDamage[msg.Username][msg.ID]+msg.Count)
+		case "SET_COMMANDER_DAMAGE":
+			err = c.Room.setCommanderDamage(msg.Username, msg.ID, msg.Count)
+		case "SET_DESIGNATION":
+			err = c.Room.setDesignation(msg.Kind, msg.Username)
+		}
+		update := map[string]interface{}{
+			"type":            "PLAYER_RESOURCE_UPDATED",
+			"player":          c.Username,
+			"username":        msg.Username,
+			"resources":       maps.Clone(c.Room.Resources[msg.Username]),
+			"commanderDamage": maps.Clone(c.Room.CommanderDamage[msg.Username]),
+			"designations":    maps.Clone(c.Room.Designations),
+		}
+		var eliminations []Elimination
+		if err == nil {
+			eliminations = c.Room.checkLosses([]string{msg.Username})
+		}
+		c.Room.mu.Unlock()
+		if err != nil {
+			c.sendError(err.Error())
+			return
+		}
+		broadcast, _ := json.Marshal(update)
+		c.Room.BroadcastSafe(broadcast)
+		c.Room.announceEliminations(eliminations)
 
-		case "DELETE_TOKEN":
-			c.Room.mu.Lock()
-			delete(c.Room.Cards, msg.ID)
-			c.Room.mu.Unlock()
-			broadcast := map[string]interface{}{
-				"type": "TOKEN_DELETED",
-				"id":   msg.ID,
-			}
-			data, _ := json.Marshal(broadcast)
-			c.Room.BroadcastExcept(data, c)
+	case "SPAWN_TOKEN":
+		c.Room.mu.Lock()
+		token := &BoardCard{
+			Card: Card{
+				ID:        msg.Card.ID,
+				Name:      msg.Card.Name,
+				ImageURL:  msg.Card.ImageURL,
+				UID:       msg.Card.UID,
+				HasTokens: msg.Card.HasTokens,
+				NumFaces:  msg.Card.NumFaces,
+				Token:     true,
+			},
+			X:          msg.Card.X,
+			Y:          msg.Card.Y,
+			Owner:      msg.Card.Owner,
+			Controller: msg.Card.Owner,
+			Tapped:     false,
+			FlipIndex:  0,
+		}
+		c.Room.Cards[token.ID] = token
+		c.Room.mu.Unlock()
+		broadcast := map[string]interface{}{
+			"type":  "SPAWN_TOKEN",
+			"token": token,
+		}
+		data, _ := json.Marshal(broadcast)
+		c.Room.BroadcastExcept(data, c)
 
-		case "CARD_PLAYED_FROM_LIBRARY":
-			c.Room.mu.Lock()
-			card := &BoardCard{
-				Card: Card{
-					ID:           msg.Card.ID,
-					Name:         msg.Card.Name,
-					ImageURL:     msg.Card.ImageURL,
-					ImageURLBack: msg.Card.ImageURLBack,
-					UID:          msg.Card.UID,
-					HasTokens:    msg.Card.HasTokens,
-					NumFaces:     msg.Card.NumFaces,
-					Token:        msg.Card.Token,
-				},
-				X:         msg.Card.X,
-				Y:         msg.Card.Y,
-				Owner:     c.Username,
-				Tapped:    false,
-				FlipIndex: msg.Card.FlipIndex,
-			}
-			c.Room.Cards[card.ID] = card
-			if deck, ok := c.Room.Decks[msg.Username]; ok {
-				filteredCards := deck.Cards[:0]
-				for _, dcard := range deck.Cards {
-					if dcard.ID != card.ID {
-						filteredCards = append(filteredCards, dcard)
-					}
-				}
-				deck.Cards = filteredCards
-			}
+	case "SPAWN_TOKENS_FOR_CARD":
+		c.Room.mu.Lock()
+		tokens, err := c.Room.spawnTokens(c.Username, msg.ID, msg.TokenID, msg.Count, msg.X, msg.Y)
+		c.Room.mu.Unlock()
+		if err != nil {
+			c.sendError(err.Error())
+			return
+		}
+		broadcast := map[string]interface{}{
+			"type":   "TOKENS_SPAWNED",
+			"source": msg.ID,
+			"player": c.Username,
+			"tokens": tokens,
+		}
+		data, _ := json.Marshal(broadcast)
+		c.Room.BroadcastSafe(data)
+
+	case "DELETE_TOKEN":
+		c.Room.mu.Lock()
+		c.Room.removeFromBoard(msg.ID)
+		c.Room.mu.Unlock()
+		broadcast := map[string]interface{}{
+			"type": "TOKEN_DELETED",
+			"id":   msg.ID,
+		}
+		data, _ := json.Marshal(broadcast)
+		c.Room.BroadcastExcept(data, c)
+
+	case "CARD_PLAYED_FROM_LIBRARY":
+		c.Room.mu.Lock()
+		libraryCard, err := c.Room.takeCard(msg.Username, ZoneLibrary, msg.Card.ID)
+		if err != nil {
 			c.Room.mu.Unlock()
-			broadcast := map[string]interface{}{
+			c.sendError(err.Error())
+			return
+		}
+		card := &BoardCard{
+			Card:       libraryCard,
+			X:          msg.Card.X,
+			Y:          msg.Card.Y,
+			Owner:      c.Username,
+			Controller: c.Username,
+			Tapped:     false,
+			FlipIndex:  msg.Card.FlipIndex,
+		}
+		if msg.Card.FaceDown {
+			card.setFaceDown(true)
+		}
+		c.Room.Cards[card.ID] = card
+		c.Room.mu.Unlock()
+		c.Room.BroadcastEachExcept(func(username string) interface{} {
+			return map[string]interface{}{
 				"type":   "CARD_PLAYED_FROM_LIBRARY",
-				"card":   card,
+				"card":   boardCardFor(card, username),
 				"player": msg.Username,
 			}
-			data, _ := json.Marshal(broadcast)
-			c.Room.BroadcastExcept(data, c)
+		}, c)
 
-		case "TAP_CARD":
-			c.Room.mu.Lock()
-			card := c.Room.Cards[msg.ID]
-			card.Tapped = msg.Tapped
-			c.Room.mu.Unlock()
-			wrapped := map[string]interface{}{
-				"type":   "CARD_TAPPED",
-				"id":     card.ID,
-				"tapped": card.Tapped,
-			}
-			updated, _ := json.Marshal(wrapped)
-			c.Room.BroadcastExcept(updated, c)
+	case "TAP_CARD":
+		c.Room.mu.Lock()
+		card := c.Room.Cards[msg.ID]
+		card.Tapped = msg.Tapped
+		c.Room.mu.Unlock()
+		wrapped := map[string]interface{}{
+			"type":   "CARD_TAPPED",
+			"id":     card.ID,
+			"tapped": card.Tapped,
+		}
+		updated, _ := json.Marshal(wrapped)
+		c.Room.BroadcastExcept(updated, c)
 
-		case "TAP_CARDS":
-			c.Room.mu.Lock()
-			for _, card := range msg.Cards {
-				c.Room.Cards[card.ID].Tapped = msg.Tapped
+	case "TAP_CARDS":
+		c.Room.mu.Lock()
+		tapped := make([]*BoardCard, 0, len(msg.Cards))
+		for _, card := range msg.Cards {
+			c.Room.Cards[card.ID].Tapped = msg.Tapped
+			tapped = append(tapped, c.Room.Cards[card.ID])
+		}
+		c.Room.mu.Unlock()
+		c.Room.BroadcastEachExcept(func(username string) interface{} {
+			cards := make([]*BoardCard, len(tapped))
+			for i, card := range tapped {
+				cards[i] = boardCardFor(card, username)
 			}
-			c.Room.mu.Unlock()
-			wrapped := map[string]interface{}{
+			return map[string]interface{}{
 				"type":   "CARDS_TAPPED",
-				"cards":  msg.Cards,
+				"cards":  cards,
 				"tapped": msg.Tapped,
 			}
-			updated, _ := json.Marshal(wrapped)
-			c.Room.BroadcastExcept(updated, c)
+		}, c)
 
-		case "SHUFFLE_DECK":
-			c.Room.mu.Lock()
-			deck := c.Room.Decks[msg.ID]
-			r := mrand.New(mrand.NewSource(time.Now().UnixNano()))
-			r.Shuffle(len(deck.Cards), func(i, j int) {
-				deck.Cards[i], deck.Cards[j] = deck.Cards[j], deck.Cards[i]
-			})
+	case "SHUFFLE_DECK":
+		c.Room.mu.Lock()
+		shuffle, err := c.Room.shuffleLibrary(msg.ID)
+		if err != nil {
 			c.Room.mu.Unlock()
-			update := map[string]interface{}{
-				"type":      "DECK_SHUFFLED",
-				"id":        msg.ID,
-				"deckCards": deck.Cards,
+			c.sendError(err.Error())
+			return
+		}
+		c.Room.mu.Unlock()
+		c.Room.BroadcastEach(func(username string) interface{} {
+			return map[string]interface{}{
+				"type":  "DECK_SHUFFLED",
+				"id":    msg.ID,
+				"deck":  c.Room.libraryFor(msg.ID, username),
+				"nonce": shuffle.Nonce,
+				"epoch": shuffle.Epoch,
 			}
-			broadcast, _ := json.Marshal(update)
-			c.Room.BroadcastSafe(broadcast)
+		})
 
-		case "FLIP_CARD":
-			c.Room.mu.Lock()
-			card := c.Room.Cards[msg.ID]
-			card.FlipIndex = msg.FlipIndex
-			c.Room.mu.Unlock()
+	case "FLIP_CARD":
+		c.Room.mu.Lock()
+		card := c.Room.Cards[msg.ID]
+		card.FlipIndex = msg.FlipIndex
+		c.Room.mu.Unlock()
+
+		wrapped := map[string]interface{}{
+			"type":      "CARD_FLIPPED",
+			"id":        card.ID,
+			"flipIndex": card.FlipIndex,
+		}
+		updated, _ := json.Marshal(wrapped)
+		c.Room.BroadcastExcept(updated, c)
+
+	case "MOVE_CARD":
+		c.Room.mu.Lock()
+		card := c.Room.Cards[msg.ID]
+		moved := c.Room.moveCards([]BoardCard{{Card: Card{ID: msg.ID}, X: msg.X, Y: msg.Y}})
+		c.Room.mu.Unlock()
+		if len(moved) > 1 {
+			c.Room.broadcastMoved(moved, nil)
+			return
+		}
+		wrapped := map[string]interface{}{
+			"type":      "MOVE_CARD",
+			"id":        card.ID,
+			"x":         card.X,
+			"y":         card.Y,
+			"flipIndex": msg.FlipIndex,
+		}
+		updated, _ := json.Marshal(wrapped)
+		c.Room.BroadcastExcept(updated, c)
+
+	case "MOVE_CARDS":
+		c.Room.mu.Lock()
+		moved := c.Room.moveCards(msg.Cards)
+		c.Room.mu.Unlock()
+		if len(moved) > len(msg.Cards) {
+			// the mover has not seen the attachments move yet
+			c.Room.broadcastMoved(moved, nil)
+		} else {
+			c.Room.broadcastMoved(moved, c)
+		}
 
-			wrapped := map[string]interface{}{
-				"type":      "CARD_FLIPPED",
-				"id":        card.ID,
-				"flipIndex": card.FlipIndex,
+	case "ATTACH_CARD", "DETACH_CARD":
+		c.Room.mu.Lock()
+		var err error
+		if msg.Type == "ATTACH_CARD" {
+			err = c.Room.attachCard(msg.ID, msg.Host)
+		} else {
+			c.Room.Cards[msg.ID].AttachedTo = ""
+		}
+		host := c.Room.Cards[msg.ID].AttachedTo
+		c.Room.mu.Unlock()
+		if err != nil {
+			c.sendError(err.Error())
+			return
+		}
+		wrapped := map[string]interface{}{
+			"type":       "CARD_ATTACHED",
+			"id":         msg.ID,
+			"attachedTo": host,
+			"player":     c.Username,
+		}
+		updated, _ := json.Marshal(wrapped)
+		c.Room.BroadcastSafe(updated)
+
+	case "TUTOR_TO_HAND":
+		c.Room.mu.Lock()
+		if card, err := c.Room.takeCard(msg.Username, ZoneLibrary, msg.ID); err == nil {
+			c.Room.addToHand(msg.Username, card)
+		}
+		handSize := len(c.Room.Hands[msg.Username])
+		c.Room.mu.Unlock()
+		broadcast := map[string]interface{}{
+			"type":     "TUTORED_TO_HAND",
+			"id":       msg.ID,
+			"player":   msg.Username,
+			"handSize": handSize,
+		}
+		data, err := json.Marshal(broadcast)
+		if err == nil {
+			c.Room.BroadcastExcept(data, c)
+		}
+
+	case "RETURN_TO_HAND":
+		c.Room.mu.Lock()
+		if card, err := c.Room.takeCard(msg.Username, ZoneBoard, msg.ID); err == nil && !card.Token {
+			c.Room.addToHand(msg.Username, card)
+		}
+		handSize := len(c.Room.Hands[msg.Username])
+		c.Room.mu.Unlock()
+
+		broadcast := map[string]interface{}{
+			"type":     "RETURN_TO_HAND",
+			"id":       msg.ID,
+			"player":   msg.Username,
+			"handSize": handSize,
+		}
+		data, err := json.Marshal(broadcast)
+		if err == nil {
+			c.Room.BroadcastExcept(data, c)
+		}
+
+	case "RETURN_CARDS_TO_HAND":
+		c.Room.mu.Lock()
+		for _, msgCard := range msg.Cards {
+			card, err := c.Room.takeCard(msg.Username, ZoneBoard, msgCard.ID)
+			if err == nil && !card.Token {
+				c.Room.addToHand(msg.Username, card)
 			}
-			updated, _ := json.Marshal(wrapped)
-			c.Room.BroadcastExcept(updated, c)
+		}
+		handSize := len(c.Room.Hands[msg.Username])
+		c.Room.mu.Unlock()
 
-		case "MOVE_CARD":
-			c.Room.mu.Lock()
-			card := c.Room.Cards[msg.ID]
-			card.X = msg.X
-			card.Y = msg.Y
-			c.Room.mu.Unlock()
-			wrapped := map[string]interface{}{
-				"type":      "MOVE_CARD",
-				"id":        card.ID,
-				"x":         card.X,
-				"y":         card.Y,
-				"flipIndex": msg.FlipIndex,
+		broadcast := map[string]interface{}{
+			"type":     "RETURN_CARDS_TO_HAND",
+			"cards":    msg.Cards,
+			"player":   msg.Username,
+			"handSize": handSize,
+		}
+		data, err := json.Marshal(broadcast)
+		if err == nil {
+			c.Room.BroadcastExcept(data, c)
+		}
+
+	case "BEGIN_SCRY":
+		c.Room.mu.Lock()
+		cards, err := c.Room.beginScry(c.Username, msg.Count, msg.Surveil)
+		c.Room.mu.Unlock()
+		if err != nil {
+			c.sendError(err.Error())
+			return
+		}
+		c.sendJSON(map[string]interface{}{
+			"type":    "SCRY_STARTED",
+			"cards":   cards,
+			"surveil": msg.Surveil,
+		})
+		update := map[string]interface{}{
+			"type":    "PLAYER_SCRYING",
+			"player":  c.Username,
+			"count":   len(cards),
+			"surveil": msg.Surveil,
+		}
+		broadcast, _ := json.Marshal(update)
+		c.Room.BroadcastExcept(broadcast, c)
+
+	case "RESOLVE_SCRY":
+		c.Room.mu.Lock()
+		toGraveyard, err := c.Room.resolveScry(c.Username, msg.Top, msg.Bottom, msg.Graveyard)
+		c.Room.mu.Unlock()
+		if err != nil {
+			c.sendError(err.Error())
+			return
+		}
+		c.Room.BroadcastEach(func(username string) interface{} {
+			return map[string]interface{}{
+				"type":        "PLAYER_SCRYED",
+				"player":      c.Username,
+				"top":         len(msg.Top),
+				"bottom":      len(msg.Bottom),
+				"toGraveyard": toGraveyard,
+				"deck":        c.Room.libraryFor(c.Username, username),
 			}
-			updated, _ := json.Marshal(wrapped)
-			c.Room.BroadcastExcept(updated, c)
+		})
 
-		case "MOVE_CARDS":
-			c.Room.mu.Lock()
-			for _, card := range msg.Cards {
-				c.Room.Cards[card.ID] = &card
+	case "MOVE_TO_ZONE":
+		c.Room.mu.Lock()
+		owner := msg.Username
+		if msg.Source == ZoneBoard {
+			if boardCard, ok := c.Room.Cards[msg.ID]; ok {
+				owner = boardCard.Owner
 			}
+		}
+		card, err := c.Room.takeCard(owner, msg.Source, msg.ID)
+		if err != nil {
 			c.Room.mu.Unlock()
-			wrapped := map[string]interface{}{
-				"type":  "CARDS_MOVED",
-				"cards": msg.Cards,
-			}
-			updated, _ := json.Marshal(wrapped)
-			c.Room.BroadcastExcept(updated, c)
-
-		case "TUTOR_TO_HAND":
-			c.Room.mu.Lock()
-			c.Room.HandSizes[msg.Username] += 1
-			handSize := c.Room.HandSizes[msg.Username]
-			if deck, ok := c.Room.Decks[msg.Username]; ok {
-				filteredCards := deck.Cards[:0]
-				for _, dcard := range deck.Cards {
-					if dcard.ID != msg.ID {
-						filteredCards = append(filteredCards, dcard)
-					}
-				}
-				deck.Cards = filteredCards
-			}
+			c.sendError(err.Error())
+			return
+		}
+		boardCard, err := c.Room.putCard(owner, msg.Source, msg.Zone, card, msg.X, msg.Y)
+		if err != nil {
+			c.Room.putCard(owner, msg.Source, msg.Source, card, msg.X, msg.Y)
 			c.Room.mu.Unlock()
-			broadcast := map[string]interface{}{
-				"type":     "TUTORED_TO_HAND",
-				"id":       msg.ID,
-				"player":   msg.Username,
-				"handSize": handSize,
+			c.sendError(err.Error())
+			return
+		}
+		if msg.Source == ZoneCommand && msg.Zone == ZoneBoard {
+			c.Room.CommanderCasts[card.ID] += 1
+		}
+		if boardCard != nil && msg.FaceDown {
+			boardCard.setFaceDown(true)
+		}
+		c.Room.mu.Unlock()
+		c.Room.BroadcastEach(func(username string) interface{} {
+			update := map[string]interface{}{
+				"type":         "CARD_MOVED_TO_ZONE",
+				"username":     c.Username,
+				"id":           card.ID,
+				"owner":        owner,
+				"source":       msg.Source,
+				"zone":         msg.Zone,
+				"handSizes":    c.Room.handSizes(),
+				"deckSize":     c.Room.deckSize(owner),
+				"deck":         c.Room.libraryFor(owner, username),
+				"commanderTax": c.Room.commanderTax(),
 			}
-			data, err := json.Marshal(broadcast)
-			if err == nil {
-				c.Room.BroadcastExcept(data, c)
+			if boardCard != nil {
+				update["card"] = boardCardFor(boardCard, username)
+			} else if cardVisibleTo(card, owner, msg.Zone, username) {
+				update["card"] = card
 			}
+			return update
+		})
 
-		case "RETURN_TO_HAND":
-			c.Room.mu.Lock()
-			delete(c.Room.Cards, msg.ID)
-			c.Room.HandSizes[msg.Username] += 1
-			handSize := c.Room.HandSizes[msg.Username]
+	case "MILL":
+		c.Room.mu.Lock()
+		deck, ok := c.Room.Decks[msg.Username]
+		if !ok {
 			c.Room.mu.Unlock()
+			return
+		}
+		milled := deck.takeTop(msg.Count)
+		for _, card := range milled {
+			c.Room.putCard(msg.Username, ZoneLibrary, ZoneGraveyard, card, 0, 0)
+		}
+		deckSize := len(deck.Cards)
+		c.Room.mu.Unlock()
+		broadcast := map[string]interface{}{
+			"type":     "PLAYER_MILLED",
+			"player":   msg.Username,
+			"cards":    milled,
+			"deckSize": deckSize,
+		}
+		data, _ := json.Marshal(broadcast)
+		c.Room.BroadcastSafe(data)
 
-			broadcast := map[string]interface{}{
-				"type":     "RETURN_TO_HAND",
-				"id":       msg.ID,
-				"player":   msg.Username,
-				"handSize": handSize,
-			}
-			data, err := json.Marshal(broadcast)
-			if err == nil {
-				c.Room.BroadcastExcept(data, c)
-			}
-
-		case "RETURN_CARDS_TO_HAND":
-			c.Room.mu.Lock()
-			for _, card := range msg.Cards {
-				delete(c.Room.Cards, card.ID)
-			}
-			c.Room.HandSizes[msg.Username] += len(msg.Cards)
-			handSize := c.Room.HandSizes[msg.Username]
+	case "SEARCH_LIBRARY":
+		c.Room.mu.Lock()
+		deck, ok := c.Room.Decks[c.Username]
+		if !ok {
 			c.Room.mu.Unlock()
+			c.sendError("Player has no library")
+			return
+		}
+		cards := deck.searchOrder()
+		c.Room.mu.Unlock()
+		c.sendJSON(map[string]interface{}{
+			"type":  "LIBRARY_SEARCHED",
+			"cards": cards,
+		})
+		update := map[string]interface{}{
+			"type":   "PLAYER_SEARCHED_LIBRARY",
+			"player": c.Username,
+		}
+		broadcast, _ := json.Marshal(update)
+		c.Room.BroadcastExcept(broadcast, c)
 
-			broadcast := map[string]interface{}{
-				"type":     "RETURN_CARDS_TO_HAND",
-				"cards":    msg.Cards,
-				"player":   msg.Username,
-				"handSize": handSize,
+	case "LOOK_AT_LIBRARY_TOP":
+		c.Room.mu.Lock()
+		deck, ok := c.Room.Decks[c.Username]
+		if !ok {
+			c.Room.mu.Unlock()
+			c.sendError("Player has no library")
+			return
+		}
+		cards := deck.peekTop(msg.Count)
+		for _, card := range cards {
+			if deck.Known[card.ID] != KnownPublic {
+				deck.know(card.ID, KnownOwner)
 			}
-			data, err := json.Marshal(broadcast)
-			if err == nil {
-				c.Room.BroadcastExcept(data, c)
+		}
+		c.Room.mu.Unlock()
+		c.sendJSON(map[string]interface{}{
+			"type":  "LIBRARY_TOP",
+			"cards": cards,
+		})
+		update := map[string]interface{}{
+			"type":   "PLAYER_LOOKED_AT_LIBRARY",
+			"player": c.Username,
+			"count":  len(cards),
+		}
+		broadcast, _ := json.Marshal(update)
+		c.Room.BroadcastExcept(broadcast, c)
+
+	case "REVEAL_LIBRARY_TOP":
+		c.Room.mu.Lock()
+		deck, ok := c.Room.Decks[c.Username]
+		if !ok {
+			c.Room.mu.Unlock()
+			c.sendError("Player has no library")
+			return
+		}
+		revealed := deck.peekTop(msg.Count)
+		for _, card := range revealed {
+			deck.know(card.ID, KnownPublic)
+		}
+		c.Room.mu.Unlock()
+		c.Room.BroadcastEach(func(username string) interface{} {
+			return map[string]interface{}{
+				"type":   "LIBRARY_REVEALED",
+				"player": c.Username,
+				"cards":  revealed,
+				"deck":   c.Room.libraryFor(c.Username, username),
 			}
+		})
 
-		case "SCRY_RESOLVED":
-			c.Room.mu.Lock()
-			c.Room.Decks[msg.Deck.ID] = &msg.Deck
+	case "SET_LIBRARY_TOP_REVEALED":
+		c.Room.mu.Lock()
+		deck, ok := c.Room.Decks[c.Username]
+		if !ok {
 			c.Room.mu.Unlock()
-			broadcast := map[string]interface{}{
-				"type": "PLAYER_SCRYED",
-				"deck": c.Room.Decks[msg.Deck.ID],
+			c.sendError("Player has no library")
+			return
+		}
+		deck.TopRevealed = msg.Revealed
+		c.Room.mu.Unlock()
+		c.Room.BroadcastEach(func(username string) interface{} {
+			return map[string]interface{}{
+				"type":   "LIBRARY_UPDATED",
+				"player": c.Username,
+				"deck":   c.Room.libraryFor(c.Username, username),
 			}
-			data, _ := json.Marshal(broadcast)
-			c.Room.BroadcastExcept(data, c)
+		})
 
-		case "SURVEIL_RESOLVED":
-			c.Room.mu.Lock()
-			c.Room.Decks[msg.Deck.ID] = &msg.Deck
-			for _, card := range msg.Cards {
-				c.Room.Cards[card.ID] = &card
+	case "REVEAL_CARD", "LOOK_AT_CARD":
+		c.Room.mu.Lock()
+		owner := msg.Username
+		if msg.Source == ZoneBoard {
+			if boardCard, ok := c.Room.Cards[msg.ID]; ok {
+				owner = boardCard.Owner
 			}
+		}
+		players := msg.Players
+		if msg.Type == "LOOK_AT_CARD" {
+			players = append([]string{c.Username}, players...)
+		}
+		card, err := c.Room.cardIn(owner, msg.Source, msg.ID)
+		if err != nil {
 			c.Room.mu.Unlock()
-			broadcast := map[string]interface{}{
-				"type":        "PLAYER_SURVEILED",
-				"deck":        c.Room.Decks[msg.Deck.ID],
-				"toGraveyard": msg.Cards,
+			c.sendError(err.Error())
+			return
+		}
+		reveal(card, owner, msg.Source, players)
+		revealed := *card
+		c.Room.mu.Unlock()
+		eventType := "CARD_REVEALED"
+		if msg.Type == "LOOK_AT_CARD" {
+			eventType = "CARD_LOOKED_AT"
+		}
+		c.Room.BroadcastEach(func(username string) interface{} {
+			update := map[string]interface{}{
+				"type":       eventType,
+				"player":     c.Username,
+				"owner":      owner,
+				"zone":       msg.Source,
+				"id":         revealed.ID,
+				"visibility": revealed.Visibility,
 			}
-			data, _ := json.Marshal(broadcast)
-			c.Room.BroadcastExcept(data, c)
+			if cardVisibleTo(revealed, owner, msg.Source, username) {
+				update["card"] = revealed
+			}
+			return update
+		})
 
-		case "ADD_COUNTER":
-			c.Room.mu.Lock()
-			counter := &Counter{
-				ID:    msg.Counters[0].ID,
-				X:     msg.Counters[0].X,
-				Y:     msg.Counters[0].Y,
-				Count: msg.Counters[0].Count,
-				Owner: msg.Counters[0].Owner,
+	case "SET_FACE_DOWN":
+		c.Room.mu.Lock()
+		card := c.Room.Cards[msg.ID]
+		card.setFaceDown(msg.FaceDown)
+		c.Room.mu.Unlock()
+		c.Room.BroadcastEach(func(username string) interface{} {
+			return map[string]interface{}{
+				"type": "CARD_FACE_CHANGED",
+				"card": boardCardFor(card, username),
 			}
-			c.Room.Counters[counter.ID] = counter
-			c.Room.mu.Unlock()
-			broadcast := map[string]interface{}{
-				"type":    "COUNTER_ADDED",
-				"counter": counter,
+		})
+
+	case "GAIN_CONTROL", "RETURN_CONTROL":
+		c.Room.mu.Lock()
+		card := c.Room.Cards[msg.ID]
+		if msg.Type == "GAIN_CONTROL" {
+			card.Controller = c.Username
+		} else {
+			card.Controller = card.Owner
+		}
+		c.Room.mu.Unlock()
+		c.Room.BroadcastEach(func(username string) interface{} {
+			return map[string]interface{}{
+				"type":   "CONTROL_CHANGED",
+				"player": c.Username,
+				"card":   boardCardFor(card, username),
 			}
-			data, _ := json.Marshal(broadcast)
-			c.Room.BroadcastExcept(data, c)
+		})
 
-		case "MOVE_COUNTER":
-			c.Room.mu.Lock()
-			counter := c.Room.Counters[msg.ID]
-			counter.X = msg.X
-			counter.Y = msg.Y
-			c.Room.mu.Unlock()
-			wrapped := map[string]interface{}{
-				"type": "COUNTER_MOVED",
-				"id":   counter.ID,
-				"x":    counter.X,
-				"y":    counter.Y,
-			}
-			updated, _ := json.Marshal(wrapped)
-			c.Room.BroadcastExcept(updated, c)
-
-		case "UPDATE_COUNTER":
-			c.Room.mu.Lock()
-			counter := c.Room.Counters[msg.ID]
-			counter.Count = msg.Count
-			c.Room.mu.Unlock()
-			wrapped := map[string]interface{}{
-				"type":  "COUNTER_UPDATED",
-				"id":    counter.ID,
-				"count": counter.Count,
+	case "CONCEDE":
+		c.Room.mu.Lock()
+		c.Room.eliminate(c.Username, LossConceded)
+		c.Room.mu.Unlock()
+		c.Room.announceEliminations([]Elimination{{Player: c.Username, Reason: LossConceded}})
+
+	case "UNDO":
+		c.Room.mu.Lock()
+		change, err := c.Room.undo(c.Username)
+		c.Room.mu.Unlock()
+		if err != nil {
+			c.sendError(err.Error())
+			return
+		}
+		c.Room.BroadcastEach(func(username string) interface{} {
+			return map[string]interface{}{
+				"type":      "ACTION_UNDONE",
+				"player":    c.Username,
+				"change":    c.Room.changeFor(change, username),
+				"handSizes": c.Room.handSizes(),
 			}
-			updated, _ := json.Marshal(wrapped)
-			c.Room.BroadcastExcept(updated, c)
+		})
 
-		case "DELETE_COUNTER":
-			c.Room.mu.Lock()
-			delete(c.Room.Counters, msg.ID)
-			c.Room.mu.Unlock()
-			wrapped := map[string]interface{}{
-				"type": "COUNTER_DELETED",
-				"id":   msg.ID,
-			}
-			updated, _ := json.Marshal(wrapped)
-			c.Room.BroadcastExcept(updated, c)
-
-		case "ADD_DICE_ROLLER":
-			c.Room.mu.Lock()
-			diceRoller := &DiceRoller{
-				ID:       msg.DiceRoller[0].ID,
-				X:        msg.DiceRoller[0].X,
-				Y:        msg.DiceRoller[0].Y,
-				NumDice:  msg.DiceRoller[0].NumDice,
-				NumSides: msg.DiceRoller[0].NumSides,
-			}
-			c.Room.DiceRollers[diceRoller.ID] = diceRoller
+	case "CAST_TO_STACK", "ADD_ABILITY_TO_STACK":
+		c.Room.mu.Lock()
+		var item *StackItem
+		var err error
+		if msg.Type == "CAST_TO_STACK" {
+			item, err = c.Room.castToStack(c.Username, msg.Source, msg.ID, msg.Zone, msg.X, msg.Y)
+		} else {
+			item, err = c.Room.addAbilityToStack(c.Username, msg.ID, msg.Card.ID, msg.Text)
+		}
+		if err != nil {
 			c.Room.mu.Unlock()
-			broadcast := map[string]interface{}{
-				"type":       "DICE_ROLLER_ADDED",
-				"diceRoller": diceRoller,
+			c.sendError(err.Error())
+			return
+		}
+		update, _ := json.Marshal(c.Room.stackState(msg.Type, c.Username, item))
+		c.Room.mu.Unlock()
+		c.Room.BroadcastSafe(update)
+
+	case "PASS_PRIORITY":
+		c.Room.mu.Lock()
+		events, err := c.Room.passPriority(c.Username)
+		var resolved []byte
+		if events.Resolved != nil {
+			state := c.Room.stackState("RESOLVE_TOP", c.Username, events.Resolved)
+			if events.Card != nil {
+				state["card"] = events.Card
 			}
-			data, _ := json.Marshal(broadcast)
-			c.Room.BroadcastExcept(data, c)
+			resolved, _ = json.Marshal(state)
+		}
+		priority, _ := json.Marshal(c.Room.priorityState())
+		c.Room.mu.Unlock()
+		if err != nil {
+			c.sendError(err.Error())
+		}
+		if resolved != nil {
+			c.Room.BroadcastSafe(resolved)
+		}
+		if events.Advanced {
+			c.Room.announceTurn(events.Turn)
+		}
+		c.Room.BroadcastSafe(priority)
+
+	case "HOLD":
+		c.Room.mu.Lock()
+		c.Room.hold(c.Username)
+		priority, _ := json.Marshal(c.Room.priorityState())
+		c.Room.mu.Unlock()
+		c.Room.BroadcastSafe(priority)
 
-		case "MOVE_DICE_ROLLER":
-			log.Printf("MOVE_DICE_ROLLER: msg.X = %f, msg.Y = %f\n", msg.X, msg.Y)
-			c.Room.mu.Lock()
-			diceRoller := c.Room.DiceRollers[msg.ID]
-			diceRoller.X = msg.X
-			diceRoller.Y = msg.Y
+	case "RESOLVE_TOP":
+		c.Room.mu.Lock()
+		item, boardCard, err := c.Room.resolveTop()
+		if err != nil {
 			c.Room.mu.Unlock()
-			wrapped := map[string]interface{}{
-				"type": "DICE_ROLLER_MOVED",
-				"id":   diceRoller.ID,
-				"x":    diceRoller.X,
-				"y":    diceRoller.Y,
-			}
-			updated, _ := json.Marshal(wrapped)
-			c.Room.BroadcastExcept(updated, c)
-
-		case "DELETE_DICE_ROLLER":
-			c.Room.mu.Lock()
-			delete(c.Room.DiceRollers, msg.ID)
+			c.sendError(err.Error())
+			return
+		}
+		state := c.Room.stackState("RESOLVE_TOP", c.Username, item)
+		if boardCard != nil {
+			state["card"] = boardCard
+		}
+		update, _ := json.Marshal(state)
+		c.Room.mu.Unlock()
+		c.Room.BroadcastSafe(update)
+
+	case "COUNTER_TOP":
+		c.Room.mu.Lock()
+		item, err := c.Room.counterTop()
+		if err != nil {
 			c.Room.mu.Unlock()
-			wrapped := map[string]interface{}{
-				"type": "DICE_ROLLER_DELETED",
-				"id":   msg.ID,
-			}
-			updated, _ := json.Marshal(wrapped)
-			c.Room.BroadcastExcept(updated, c)
+			c.sendError(err.Error())
+			return
+		}
+		update, _ := json.Marshal(c.Room.stackState(msg.Type, c.Username, item))
+		c.Room.mu.Unlock()
+		c.Room.BroadcastSafe(update)
 
-		case "ROLL_DICE":
-			wrapped := map[string]interface{}{
-				"type":    "DICE_ROLLED",
-				"id":      msg.ID,
-				"results": msg.DiceResults,
-			}
-			broadcast, _ := json.Marshal(wrapped)
-			c.Room.BroadcastExcept(broadcast, c)
+	case "CREATE_ARROW":
+		c.Room.mu.Lock()
+		arrow, err := c.Room.addArrow(c.Username, msg.Arrow)
+		c.Room.mu.Unlock()
+		if err != nil {
+			c.sendError(err.Error())
+			return
+		}
+		broadcast := map[string]interface{}{
+			"type":  "ARROW_CREATED",
+			"arrow": arrow,
+		}
+		data, _ := json.Marshal(broadcast)
+		c.Room.BroadcastExcept(data, c)
+
+	case "DELETE_ARROW":
+		c.Room.mu.Lock()
+		delete(c.Room.Arrows, msg.ID)
+		c.Room.mu.Unlock()
+		wrapped := map[string]interface{}{
+			"type": "ARROW_DELETED",
+			"id":   msg.ID,
 		}
+		updated, _ := json.Marshal(wrapped)
+		c.Room.BroadcastExcept(updated, c)
+
+	case "ADD_COUNTER":
+		c.Room.mu.Lock()
+		counter := &Counter{
+			ID:    msg.Counters[0].ID,
+			X:     msg.Counters[0].X,
+			Y:     msg.Counters[0].Y,
+			Count: msg.Counters[0].Count,
+			Owner: msg.Counters[0].Owner,
+		}
+		c.Room.Counters[counter.ID] = counter
+		c.Room.mu.Unlock()
+		broadcast := map[string]interface{}{
+			"type":    "COUNTER_ADDED",
+			"counter": counter,
+		}
+		data, _ := json.Marshal(broadcast)
+		c.Room.BroadcastExcept(data, c)
+
+	case "MOVE_COUNTER":
+		c.Room.mu.Lock()
+		counter := c.Room.Counters[msg.ID]
+		counter.X = msg.X
+		counter.Y = msg.Y
+		c.Room.mu.Unlock()
+		wrapped := map[string]interface{}{
+			"type": "COUNTER_MOVED",
+			"id":   counter.ID,
+			"x":    counter.X,
+			"y":    counter.Y,
+		}
+		updated, _ := json.Marshal(wrapped)
+		c.Room.BroadcastExcept(updated, c)
+
+	case "UPDATE_COUNTER":
+		c.Room.mu.Lock()
+		counter := c.Room.Counters[msg.ID]
+		counter.Count = msg.Count
+		c.Room.mu.Unlock()
+		wrapped := map[string]interface{}{
+			"type":  "COUNTER_UPDATED",
+			"id":    counter.ID,
+			"count": counter.Count,
+		}
+		updated, _ := json.Marshal(wrapped)
+		c.Room.BroadcastExcept(updated, c)
+
+	case "DELETE_COUNTER":
+		c.Room.mu.Lock()
+		delete(c.Room.Counters, msg.ID)
+		c.Room.mu.Unlock()
+		wrapped := map[string]interface{}{
+			"type": "COUNTER_DELETED",
+			"id":   msg.ID,
+		}
+		updated, _ := json.Marshal(wrapped)
+		c.Room.BroadcastExcept(updated, c)
+
+	case "ADD_CARD_COUNTER", "SET_CARD_COUNTER":
+		c.Room.mu.Lock()
+		card := c.Room.Cards[msg.ID]
+		count := msg.Count
+		if msg.Type == "ADD_CARD_COUNTER" {
+			count += card.Counters[msg.Kind]
+		}
+		err := card.setCounter(msg.Kind, count)
+		counters := maps.Clone(card.Counters)
+		c.Room.mu.Unlock()
+		if err != nil {
+			c.sendError(err.Error())
+			return
+		}
+		wrapped := map[string]interface{}{
+			"type":     "CARD_COUNTERS_UPDATED",
+			"id":       msg.ID,
+			"player":   c.Username,
+			"counters": counters,
+		}
+		updated, _ := json.Marshal(wrapped)
+		c.Room.BroadcastSafe(updated)
+
+	case "ADD_DICE_ROLLER":
+		c.Room.mu.Lock()
+		diceRoller := &DiceRoller{
+			ID:       msg.DiceRoller[0].ID,
+			X:        msg.DiceRoller[0].X,
+			Y:        msg.DiceRoller[0].Y,
+			NumDice:  msg.DiceRoller[0].NumDice,
+			NumSides: msg.DiceRoller[0].NumSides,
+			Owner:    c.Username,
+		}
+		c.Room.DiceRollers[diceRoller.ID] = diceRoller
+		c.Room.mu.Unlock()
+		broadcast := map[string]interface{}{
+			"type":       "DICE_ROLLER_ADDED",
+			"diceRoller": diceRoller,
+		}
+		data, _ := json.Marshal(broadcast)
+		c.Room.BroadcastExcept(data, c)
+
+	case "MOVE_DICE_ROLLER":
+		log.Printf("MOVE_DICE_ROLLER: msg.X = %f, msg.Y = %f\n", msg.X, msg.Y)
+		c.Room.mu.Lock()
+		diceRoller := c.Room.DiceRollers[msg.ID]
+		diceRoller.X = msg.X
+		diceRoller.Y = msg.Y
+		c.Room.mu.Unlock()
+		wrapped := map[string]interface{}{
+			"type": "DICE_ROLLER_MOVED",
+			"id":   diceRoller.ID,
+			"x":    diceRoller.X,
+			"y":    diceRoller.Y,
+		}
+		updated, _ := json.Marshal(wrapped)
+		c.Room.BroadcastExcept(updated, c)
+
+	case "DELETE_DICE_ROLLER":
+		c.Room.mu.Lock()
+		delete(c.Room.DiceRollers, msg.ID)
+		c.Room.mu.Unlock()
+		wrapped := map[string]interface{}{
+			"type": "DICE_ROLLER_DELETED",
+			"id":   msg.ID,
+		}
+		updated, _ := json.Marshal(wrapped)
+		c.Room.BroadcastExcept(updated, c)
+
+	case "ROLL_DICE":
+		c.Room.mu.Lock()
+		roll, err := c.Room.rollDice(c.Username, msg.ID)
+		c.Room.mu.Unlock()
+		if err != nil {
+			c.sendError(err.Error())
+			return
+		}
+		wrapped := map[string]interface{}{
+			"type":    "DICE_ROLLED",
+			"id":      msg.ID,
+			"results": roll.Results,
+			"player":  roll.Player,
+			"nonce":   roll.Nonce,
+			"epoch":   roll.Epoch,
+		}
+		broadcast, _ := json.Marshal(wrapped)
+		c.Room.BroadcastSafe(broadcast)
 	}
 }
 
@@ -730,8 +1307,8 @@ func (c *Client) write() {
 	for {
 		select {
 		case msg, ok := <-c.Send:
-			if !ok {
-				log.Printf("Send channel closed, exiting write goroutine for user %s", c.Username)
+			if !ok || msg == nil {
+				log.Printf("Hanging up, exiting write goroutine for user %s", c.Username)
 				c.Conn.WriteMessage(websocket.CloseMessage, []byte{})
 				return
 			}
@@ -750,17 +1327,17 @@ func (c *Client) write() {
 	}
 }
 
+func (c *Client) sendJSON(payload interface{}) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+	c.Room.deliver(delivery{client: c, data: data})
+}
+
 func (c *Client) sendError(reason string) {
-	msg := map[string]string{
+	c.sendJSON(map[string]string{
 		"type":   "ERROR",
 		"reason": reason,
-	}
-	if data, err := json.Marshal(msg); err == nil {
-		select {
-		case c.Send <- data:
-			time.Sleep(100 * time.Millisecond)
-		default:
-			log.Printf("unable to send error to client: channel blocked")
-		}
-	}
+	})
 }
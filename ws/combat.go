@@ -0,0 +1,284 @@
+package ws
+
+import (
+	"errors"
+	"slices"
+	"sort"
+)
+
+// Attack is one attacking creature, what it attacks, and what blocks it.
+// An attack targets either a player or a planeswalker on the board.
+type Attack struct {
+	Attacker     string   `json:"attacker"`
+	Player       string   `json:"player,omitempty"`
+	Planeswalker string   `json:"planeswalker,omitempty"`
+	Vigilance    bool     `json:"vigilance,omitempty"`
+	Blockers     []string `json:"blockers"`
+	// Assigned is set once the attacker has dealt its combat damage, and
+	// BlockersAssigned lists the blockers that have dealt theirs.
+	Assigned         bool     `json:"assigned,omitempty"`
+	BlockersAssigned []string `json:"blockersAssigned,omitempty"`
+}
+
+type Block struct {
+	Blocker  string `json:"blocker"`
+	Attacker string `json:"attacker"`
+}
+
+// DamageAssignment is combat damage dealt by an attacker or blocker to a
+// player or to a card.
+type DamageAssignment struct {
+	Source string `json:"source"`
+	Player string `json:"player,omitempty"`
+	Card   string `json:"card,omitempty"`
+	Amount int    `json:"amount"`
+}
+
+// defender is the player an attack is aimed at, directly or through one of
+// their planeswalkers.
+func (r *Room) defender(attack *Attack) string {
+	if attack.Planeswalker != "" {
+		if card, ok := r.Cards[attack.Planeswalker]; ok {
+			return card.controlledBy()
+		}
+		return ""
+	}
+	return attack.Player
+}
+
+// declareAttackers starts combat for the active player. Attackers are tapped
+// unless they have vigilance. The caller must hold r.mu.
+func (r *Room) declareAttackers(username string, attacks []Attack) ([]string, error) {
+	if len(r.Combat) > 0 {
+		return nil, errors.New("attackers have already been declared")
+	}
+	if len(attacks) == 0 {
+		return nil, errors.New("no attackers declared")
+	}
+	declared := make(map[string]*Attack, len(attacks))
+	for _, attack := range attacks {
+		card, ok := r.Cards[attack.Attacker]
+		if !ok || card.controlledBy() != username {
+			return nil, errors.New("you can only attack with creatures you control")
+		}
+		if card.Tapped {
+			return nil, errors.New("tapped creatures cannot attack")
+		}
+		if _, ok := declared[attack.Attacker]; ok {
+			return nil, errors.New("a creature can only attack once")
+		}
+		if (attack.Player == "") == (attack.Planeswalker == "") {
+			return nil, errors.New("each attacker must attack one player or planeswalker")
+		}
+		target := &Attack{
+			Attacker:     attack.Attacker,
+			Player:       attack.Player,
+			Planeswalker: attack.Planeswalker,
+			Vigilance:    attack.Vigilance,
+			Blockers:     []string{},
+		}
+		defender := r.defender(target)
+		if _, seated := r.PlayerPositions[defender]; !seated || defender == username {
+			return nil, errors.New("attackers must attack an opponent or their planeswalker")
+		}
+		if _, out := r.Eliminated[defender]; out {
+			return nil, errors.New("eliminated players cannot be attacked")
+		}
+		declared[attack.Attacker] = target
+	}
+
+	var tapped []string
+	for id, attack := range declared {
+		if !attack.Vigilance {
+			r.Cards[id].Tapped = true
+			tapped = append(tapped, id)
+		}
+	}
+	r.Combat = declared
+	r.enterStep(StepDeclareAttackers)
+	return tapped, nil
+}
+
+// declareBlockers adds a defending player's blocks. Each blocker blocks one
+// attacker that is attacking that player or their planeswalker. The caller
+// must hold r.mu.
+func (r *Room) declareBlockers(username string, blocks []Block) error {
+	if len(r.Combat) == 0 {
+		return errors.New("no attackers to block")
+	}
+	blocking := make(map[string]bool)
+	for _, attack := range r.Combat {
+		for _, blocker := range attack.Blockers {
+			blocking[blocker] = true
+		}
+	}
+	for _, block := range blocks {
+		card, ok := r.Cards[block.Blocker]
+		if !ok || card.controlledBy() != username {
+			return errors.New("you can only block with creatures you control")
+		}
+		if card.Tapped {
+			return errors.New("tapped creatures cannot block")
+		}
+		if blocking[block.Blocker] {
+			return errors.New("a creature can only block once")
+		}
+		attack, ok := r.Combat[block.Attacker]
+		if !ok {
+			return errors.New("that creature is not attacking")
+		}
+		if r.defender(attack) != username {
+			return errors.New("you can only block creatures attacking you")
+		}
+		blocking[block.Blocker] = true
+	}
+	for _, block := range blocks {
+		attack := r.Combat[block.Attacker]
+		attack.Blockers = append(attack.Blockers, block.Blocker)
+	}
+	r.enterStep(StepDeclareBlockers)
+	return nil
+}
+
+// assignDamage deals combat damage from sources the player controls.
+// Attackers damage what they attack or what blocks them, and blockers damage
+// what they block. Damage to a player from a commander also counts as
+// commander damage; damage to a planeswalker removes loyalty; damage to
+// anything else is marked on the card until cleanup. Each source deals its
+// damage once per combat, split across its targets in a single assignment.
+// The caller must hold r.mu.
+func (r *Room) assignDamage(username string, assignments []DamageAssignment) error {
+	if len(r.Combat) == 0 {
+		return errors.New("there is no combat")
+	}
+	for _, assignment := range assignments {
+		if r.hasDealtDamage(assignment.Source) {
+			return errors.New("that creature has already dealt its combat damage")
+		}
+		if assignment.Amount < 0 {
+			return errors.New("damage cannot be negative")
+		}
+		source, ok := r.Cards[assignment.Source]
+		if !ok || source.controlledBy() != username {
+			return errors.New("you can only assign damage from creatures you control")
+		}
+		if !r.canDamage(assignment) {
+			return errors.New("that creature cannot deal damage to that target")
+		}
+	}
+
+	for _, assignment := range assignments {
+		r.markDealtDamage(assignment.Source)
+		if assignment.Amount == 0 {
+			continue
+		}
+		if assignment.Player != "" {
+			r.LifeTotals[assignment.Player] -= assignment.Amount
+			if r.isCommander(assignment.Source) {
+				damage := r.CommanderDamage[assignment.Player][assignment.Source] + assignment.Amount
+				r.setCommanderDamage(assignment.Player, assignment.Source, damage)
+			}
+			continue
+		}
+		card := r.Cards[assignment.Card]
+		if loyalty, ok := card.Counters[CounterLoyalty]; ok {
+			card.setCounter(CounterLoyalty, loyalty-assignment.Amount)
+		} else {
+			card.Damage += assignment.Amount
+		}
+	}
+	r.enterStep(StepCombatDamage)
+	return nil
+}
+
+func (r *Room) hasDealtDamage(source string) bool {
+	if attack, ok := r.Combat[source]; ok {
+		return attack.Assigned
+	}
+	for _, attack := range r.Combat {
+		if slices.Contains(attack.BlockersAssigned, source) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Room) markDealtDamage(source string) {
+	if attack, ok := r.Combat[source]; ok {
+		attack.Assigned = true
+		return
+	}
+	for _, attack := range r.Combat {
+		if slices.Contains(attack.Blockers, source) && !slices.Contains(attack.BlockersAssigned, source) {
+			attack.BlockersAssigned = append(attack.BlockersAssigned, source)
+		}
+	}
+}
+
+func (r *Room) canDamage(assignment DamageAssignment) bool {
+	if (assignment.Player == "") == (assignment.Card == "") {
+		return false
+	}
+	if assignment.Card != "" {
+		if _, ok := r.Cards[assignment.Card]; !ok {
+			return false
+		}
+	}
+	if attack, ok := r.Combat[assignment.Source]; ok {
+		if assignment.Player != "" {
+			return assignment.Player == attack.Player
+		}
+		return assignment.Card == attack.Planeswalker || slices.Contains(attack.Blockers, assignment.Card)
+	}
+	for _, attack := range r.Combat {
+		if slices.Contains(attack.Blockers, assignment.Source) {
+			return assignment.Card == attack.Attacker
+		}
+	}
+	return false
+}
+
+// combatView lists the attacks still in combat, dropping creatures that have
+// left the board since they were declared.
+func (r *Room) combatView() []Attack {
+	attacks := make([]Attack, 0, len(r.Combat))
+	for id, attack := range r.Combat {
+		if _, ok := r.Cards[id]; !ok {
+			continue
+		}
+		view := *attack
+		view.Blockers = []string{}
+		for _, blocker := range attack.Blockers {
+			if _, ok := r.Cards[blocker]; ok {
+				view.Blockers = append(view.Blockers, blocker)
+			}
+		}
+		attacks = append(attacks, view)
+	}
+	sort.Slice(attacks, func(i, j int) bool {
+		return attacks[i].Attacker < attacks[j].Attacker
+	})
+	return attacks
+}
+
+func (r *Room) combatState() map[string]interface{} {
+	return map[string]interface{}{
+		"type":     "COMBAT_STATE",
+		"turn":     r.Turn,
+		"phase":    phaseOf(r.Step),
+		"step":     r.Step,
+		"priority": r.Priority,
+		"attacks":  r.combatView(),
+	}
+}
+
+func (r *Room) endCombat() {
+	r.Combat = make(map[string]*Attack)
+}
+
+// clearDamage removes the damage marked on cards, as happens in cleanup.
+func (r *Room) clearDamage() {
+	for _, card := range r.Cards {
+		card.Damage = 0
+	}
+}
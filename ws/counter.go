@@ -1,5 +1,7 @@
 package ws
 
+import "errors"
+
 type Counter struct {
 	ID    string  `json:"id"`
 	X     float64 `json:"x"`
@@ -7,3 +9,42 @@ type Counter struct {
 	Count int     `json:"count"`
 	Owner string  `json:"owner"`
 }
+
+// Kinds of counters that can be put on a card. Any other non-empty kind is
+// accepted as a custom counter.
+const (
+	CounterPlusOne  = "+1/+1"
+	CounterMinusOne = "-1/-1"
+	CounterLoyalty  = "loyalty"
+	CounterPoison   = "poison"
+	CounterCharge   = "charge"
+)
+
+const maxCounterKindLength = 32
+
+// setCounter sets how many counters of a kind are on the card. +1/+1 and
+// -1/-1 counters cancel each other out.
+func (c *BoardCard) setCounter(kind string, count int) error {
+	if kind == "" || len(kind) > maxCounterKindLength {
+		return errors.New("invalid counter kind")
+	}
+	if count < 0 {
+		count = 0
+	}
+	if c.Counters == nil {
+		c.Counters = make(map[string]int)
+	}
+	c.Counters[kind] = count
+	plus, minus := c.Counters[CounterPlusOne], c.Counters[CounterMinusOne]
+	if plus > 0 && minus > 0 {
+		cancelled := min(plus, minus)
+		c.Counters[CounterPlusOne] -= cancelled
+		c.Counters[CounterMinusOne] -= cancelled
+	}
+	for kind, count := range c.Counters {
+		if count == 0 {
+			delete(c.Counters, kind)
+		}
+	}
+	return nil
+}
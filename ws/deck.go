@@ -1,9 +1,11 @@
 package ws
 
 type Deck struct {
-	ID         string  `json:"id"`
-	X          float64 `json:"x"`
-	Y          float64 `json:"y"`
-	Cards      []Card  `json:"cards"`
-	Commanders []Card  `json:"commanders"`
+	ID          string            `json:"id"`
+	X           float64           `json:"x"`
+	Y           float64           `json:"y"`
+	Cards       []Card            `json:"cards"`
+	Commanders  []Card            `json:"commanders"`
+	Known       map[string]string `json:"known,omitempty"`
+	TopRevealed bool              `json:"topRevealed,omitempty"`
 }
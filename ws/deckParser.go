@@ -1,18 +1,34 @@
 package ws
 
 import (
-	crand "crypto/rand"
-	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
-	mrand "math/rand"
-	"net/http"
+	"net/url"
 	"strings"
 )
 
-func WebpageURLToAPIURL(webpageURL string) (string, error) {
+type ArchidektSource struct {
+	APIBase string
+}
+
+func (s *ArchidektSource) Matches(deckURL *url.URL) bool {
+	return hostMatches(deckURL, "archidekt.com")
+}
+
+func (s *ArchidektSource) FetchDeck(deckURL string) ([]Card, []Card, error) {
+	deckID, err := archidektDeckID(deckURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch deck: %w", err)
+	}
+	data, err := fetchURL(fmt.Sprintf("%s/decks/%s/", s.APIBase, deckID))
+	if err != nil {
+		return nil, nil, err
+	}
+	return ParseDeck(data)
+}
+
+func archidektDeckID(webpageURL string) (string, error) {
 	parts := strings.Split(webpageURL, "/")
 	if len(parts) < 5 {
 		return "", errors.New("invalid deck webpage URL")
@@ -20,26 +36,24 @@ func WebpageURLToAPIURL(webpageURL string) (string, error) {
 	if parts[3] != "decks" {
 		return "", errors.New("URL is not a deck URL")
 	}
-	deckID := parts[4]
+	return parts[4], nil
+}
+
+func WebpageURLToAPIURL(webpageURL string) (string, error) {
+	deckID, err := archidektDeckID(webpageURL)
+	if err != nil {
+		return "", err
+	}
 	apiURL := fmt.Sprintf("https://archidekt.com/api/decks/%s/", deckID)
 	return apiURL, nil
 }
 
 func FetchDeckJSON(deckURL string) ([]byte, error) {
-	client := GetLoggingClient()
 	apiURL, err := WebpageURLToAPIURL(deckURL)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch deck: %w", err)
 	}
-	resp, err := client.Get(apiURL)
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch deck: %w", err)
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("non-200 response: %s", resp.Status)
-	}
-	return io.ReadAll(resp.Body)
+	return fetchURL(apiURL)
 }
 
 func ParseDeck(data []byte) ([]Card, []Card, error) {
@@ -85,11 +99,6 @@ func ParseDeck(data []byte) ([]Card, []Card, error) {
 			c.Card.Edition.EditionCode,
 			c.Card.CollectorNumber,
 		)
-		nonStandardBackLayouts := map[string]bool{
-			"modal_dfc": true,
-			"transform": true,
-			"meld":      true,
-		}
 		imageURLBack := ""
 		if nonStandardBackLayouts[c.Card.OracleCard.Layout] && c.Card.UID != "" && c.Card.ScryfallImageHash != "" {
 			uidClean := strings.ReplaceAll(c.Card.UID, "-", "")
@@ -109,13 +118,14 @@ func ParseDeck(data []byte) ([]Card, []Card, error) {
 				break
 			}
 		}
+		if err := checkQuantity(c.Card.OracleCard.Name, c.Quantity, len(allCards)+len(commanderCards)); err != nil {
+			return nil, nil, err
+		}
 		for i := 0; i < c.Quantity; i++ {
-			suffix := make([]byte, 4)
-			_, err := crand.Read(suffix)
+			uniqueID, err := newCardID()
 			if err != nil {
-				return nil, nil, fmt.Errorf("error generating card ID: %w", err)
+				return nil, nil, err
 			}
-			uniqueID := fmt.Sprintf("%d-%s", c.Card.ID, hex.EncodeToString(suffix))
 			numFaces := 2
 			if imageURLBack != "" {
 				numFaces = 3
@@ -130,6 +140,18 @@ func ParseDeck(data []byte) ([]Card, []Card, error) {
 				NumFaces:     numFaces,
 				Token:        false,
 			}
+			if cardCatalog != nil {
+				if catalogCard, ok := cardCatalog.ByID(c.Card.UID); ok {
+					card.Layout = catalogCard.Layout
+					card.Faces = catalogCard.Faces
+					card.Tokens = catalogCard.Tokens
+				}
+			}
+			if len(card.Tokens) == 0 {
+				for _, tokenID := range c.Card.OracleCard.Tokens {
+					card.Tokens = append(card.Tokens, newTokenRef(tokenID))
+				}
+			}
 			if isCommander {
 				commanderCards = append(commanderCards, card)
 			} else {
@@ -137,8 +159,5 @@ func ParseDeck(data []byte) ([]Card, []Card, error) {
 			}
 		}
 	}
-	mrand.Shuffle(len(allCards), func(i, j int) {
-		allCards[i], allCards[j] = allCards[j], allCards[i]
-	})
 	return allCards, commanderCards, nil
 }
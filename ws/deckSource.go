@@ -0,0 +1,168 @@
+package ws
+
+import (
+	crand "crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DeckSource fetches and parses decklists from one deck-building site. The
+// returned cards are the library and the commanders, in list order.
+type DeckSource interface {
+	Matches(deckURL *url.URL) bool
+	FetchDeck(deckURL string) ([]Card, []Card, error)
+}
+
+// Limits on what a decklist may ask for, so that a bad list cannot make the
+// server build millions of cards.
+const (
+	maxCardQuantity = 250
+	maxDeckSize     = 1000
+)
+
+// checkQuantity refuses an entry of quantity copies that would take a deck
+// already holding deckSize cards over the limits.
+func checkQuantity(name string, quantity int, deckSize int) error {
+	if quantity > maxCardQuantity {
+		return fmt.Errorf("too many copies of %s: %d", name, quantity)
+	}
+	if deckSize+quantity > maxDeckSize {
+		return fmt.Errorf("deck has more than %d cards", maxDeckSize)
+	}
+	return nil
+}
+
+var deckSources = []DeckSource{
+	&ArchidektSource{APIBase: "https://archidekt.com/api"},
+	&MoxfieldSource{APIBase: "https://api2.moxfield.com/v3"},
+	&MTGGoldfishSource{BaseURL: "https://www.mtggoldfish.com"},
+}
+
+// LoadDeck fetches a deck from whichever source hosts deckURL and returns
+// the library, in list order, along with the commanders.
+func LoadDeck(deckURL string) ([]Card, []Card, error) {
+	u, err := url.Parse(deckURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid deck URL: %w", err)
+	}
+	for _, source := range deckSources {
+		if source.Matches(u) {
+			return source.FetchDeck(deckURL)
+		}
+	}
+	return nil, nil, fmt.Errorf("unsupported deck site: %s", u.Host)
+}
+
+// LoadDeckList parses a decklist pasted as plain text.
+func LoadDeckList(text string) ([]Card, []Card, error) {
+	deck, err := ParseDeckText(text)
+	if err != nil {
+		return nil, nil, err
+	}
+	return deck.cards()
+}
+
+func hostMatches(deckURL *url.URL, host string) bool {
+	return strings.TrimPrefix(strings.ToLower(deckURL.Hostname()), "www.") == host
+}
+
+func fetchURL(apiURL string) ([]byte, error) {
+	client := GetLoggingClient()
+	resp, err := client.Get(apiURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch deck: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("non-200 response: %s", resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// deckPathID returns the path segment following segment in a deck webpage
+// URL, e.g. the ID in https://moxfield.com/decks/<id>.
+func deckPathID(deckURL string, segment string) (string, error) {
+	u, err := url.Parse(deckURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid deck URL: %w", err)
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	for i := 0; i < len(parts)-1; i++ {
+		if parts[i] == segment && parts[i+1] != "" {
+			return parts[i+1], nil
+		}
+	}
+	return "", fmt.Errorf("URL is not a deck URL: %s", deckURL)
+}
+
+func newCardID() (string, error) {
+	id := make([]byte, 8)
+	if _, err := crand.Read(id); err != nil {
+		return "", fmt.Errorf("error generating card ID: %w", err)
+	}
+	return hex.EncodeToString(id), nil
+}
+
+func scryfallImageURL(set, collectorNumber string, back bool) string {
+	imageURL := fmt.Sprintf(
+		"https://api.scryfall.com/cards/%s/%s?format=image&version=normal",
+		strings.ToLower(set),
+		url.PathEscape(collectorNumber),
+	)
+	if back {
+		imageURL += "&face=back"
+	}
+	return imageURL
+}
+
+func scryfallNamedImageURL(name string) string {
+	return fmt.Sprintf(
+		"https://api.scryfall.com/cards/named?exact=%s&format=image&version=normal",
+		url.QueryEscape(name),
+	)
+}
+
+var nonStandardBackLayouts = map[string]bool{
+	"modal_dfc": true,
+	"transform": true,
+	"meld":      true,
+}
+
+// newDeckCard builds a card from a decklist entry, resolved through the card
+// catalog when one is loaded. Otherwise, without a set and collector number
+// the image is looked up on Scryfall by name.
+func newDeckCard(name, set, collectorNumber, layout, uid string) (Card, error) {
+	if cardCatalog != nil {
+		if catalogCard, ok := cardCatalog.Resolve(name, set, collectorNumber); ok {
+			return catalogCard.NewCard()
+		}
+	}
+	id, err := newCardID()
+	if err != nil {
+		return Card{}, err
+	}
+	imageURL := scryfallNamedImageURL(name)
+	imageURLBack := ""
+	if set != "" && collectorNumber != "" {
+		imageURL = scryfallImageURL(set, collectorNumber, false)
+		if nonStandardBackLayouts[layout] {
+			imageURLBack = scryfallImageURL(set, collectorNumber, true)
+		}
+	}
+	numFaces := 2
+	if imageURLBack != "" {
+		numFaces = 3
+	}
+	return Card{
+		ID:           id,
+		Name:         name,
+		ImageURL:     imageURL,
+		ImageURLBack: imageURLBack,
+		UID:          uid,
+		NumFaces:     numFaces,
+	}, nil
+}
@@ -0,0 +1,145 @@
+package ws
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+// serveFixture stands in for a deck site, answering path with a file from
+// testdata.
+func serveFixture(t *testing.T, path string, fixture string) *httptest.Server {
+	t.Helper()
+	data, err := os.ReadFile("testdata/" + fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != path {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func cardNames(cards []Card) []string {
+	names := make([]string, len(cards))
+	for i, card := range cards {
+		names[i] = card.Name
+	}
+	return names
+}
+
+func TestDeckSources(t *testing.T) {
+	tests := []struct {
+		name       string
+		path       string
+		fixture    string
+		source     func(base string) DeckSource
+		deckURL    string
+		cards      []string
+		commanders []string
+	}{
+		{
+			name:       "archidekt",
+			path:       "/decks/123/",
+			fixture:    "archidekt_deck.json",
+			source:     func(base string) DeckSource { return &ArchidektSource{APIBase: base} },
+			deckURL:    "https://archidekt.com/decks/123/jeska",
+			cards:      []string{"Mountain", "Mountain", "Mountain"},
+			commanders: []string{"Jeska, Thrice Reborn"},
+		},
+		{
+			name:       "moxfield",
+			path:       "/decks/all/abc",
+			fixture:    "moxfield_deck.json",
+			source:     func(base string) DeckSource { return &MoxfieldSource{APIBase: base} },
+			deckURL:    "https://moxfield.com/decks/abc",
+			cards:      []string{"Sol Ring", "Forest", "Forest"},
+			commanders: []string{"Atraxa, Praetors' Voice"},
+		},
+		{
+			name:       "mtggoldfish",
+			path:       "/deck/download/42",
+			fixture:    "mtggoldfish_deck.txt",
+			source:     func(base string) DeckSource { return &MTGGoldfishSource{BaseURL: base} },
+			deckURL:    "https://www.mtggoldfish.com/deck/42",
+			cards:      []string{"Sol Ring", "Island", "Island", "Counterspell"},
+			commanders: []string{"Talrand, Sky Summoner"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := serveFixture(t, tt.path, tt.fixture)
+			cards, commanders, err := tt.source(server.URL).FetchDeck(tt.deckURL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !sameOrder(cardNames(cards), tt.cards) {
+				t.Errorf("cards = %v, want %v", cardNames(cards), tt.cards)
+			}
+			if !sameOrder(cardNames(commanders), tt.commanders) {
+				t.Errorf("commanders = %v, want %v", cardNames(commanders), tt.commanders)
+			}
+			seen := make(map[string]bool)
+			for _, card := range append(cards, commanders...) {
+				if card.ID == "" || seen[card.ID] {
+					t.Errorf("card %q has a missing or repeated id %q", card.Name, card.ID)
+				}
+				seen[card.ID] = true
+			}
+		})
+	}
+}
+
+func TestDeckSourceHTTPError(t *testing.T) {
+	server := serveFixture(t, "/nowhere", "moxfield_deck.json")
+	source := &MoxfieldSource{APIBase: server.URL}
+	if _, _, err := source.FetchDeck("https://moxfield.com/decks/abc"); err == nil {
+		t.Fatal("expected an error for a missing deck")
+	}
+}
+
+func TestLoadDeckListLimits(t *testing.T) {
+	if _, _, err := LoadDeckList("1000000000 Island"); err == nil {
+		t.Error("expected a huge quantity to be refused")
+	}
+	if _, _, err := LoadDeckList("250 Island\n250 Swamp\n250 Forest\n250 Plains\n1 Wastes"); err == nil {
+		t.Error("expected an oversized deck to be refused")
+	}
+	cards, _, err := LoadDeckList("99 Relentless Rats")
+	if err != nil || len(cards) != 99 {
+		t.Errorf("got %d cards, %v", len(cards), err)
+	}
+}
+
+func TestArchidektTokenNamesWithoutCatalog(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/cards/treasure-token" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"name": "Treasure"}`))
+	}))
+	t.Cleanup(server.Close)
+	defer func(base string) { scryfallAPIBase = base }(scryfallAPIBase)
+	scryfallAPIBase = server.URL
+
+	cards, _, err := ParseDeck([]byte(`{"cards": [{"quantity": 1, "card": {"oracleCard": {"name": "Smothering Tithe", "tokens": ["treasure-token", "unknown-token"]}}}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cards) != 1 || len(cards[0].Tokens) != 2 {
+		t.Fatalf("got %+v", cards)
+	}
+	if name := cards[0].Tokens[0].Name; name != "Treasure" {
+		t.Errorf("token name = %q, want Treasure", name)
+	}
+	if name := cards[0].Tokens[1].Name; name != "Token" {
+		t.Errorf("unknown token name = %q, want Token", name)
+	}
+}
@@ -0,0 +1,180 @@
+package ws
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type MTGGoldfishSource struct {
+	BaseURL string
+}
+
+func (s *MTGGoldfishSource) Matches(deckURL *url.URL) bool {
+	return hostMatches(deckURL, "mtggoldfish.com")
+}
+
+func (s *MTGGoldfishSource) FetchDeck(deckURL string) ([]Card, []Card, error) {
+	deckID, err := deckPathID(deckURL, "deck")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch deck: %w", err)
+	}
+	data, err := fetchURL(fmt.Sprintf("%s/deck/download/%s", s.BaseURL, deckID))
+	if err != nil {
+		return nil, nil, err
+	}
+	deck, err := ParseDeckText(string(data))
+	if err != nil {
+		return nil, nil, err
+	}
+	// MTGGoldfish exports commanders as a short trailing sideboard
+	if len(deck.Commanders) == 0 && len(deck.Sideboard) > 0 && len(deck.Sideboard) <= 2 {
+		deck.Commanders = deck.Sideboard
+		deck.Sideboard = nil
+	}
+	return deck.cards()
+}
+
+type DeckEntry struct {
+	Quantity        int
+	Name            string
+	Set             string
+	CollectorNumber string
+}
+
+// TextDeck is a decklist in the MTGO / Arena text format.
+type TextDeck struct {
+	Cards      []DeckEntry
+	Commanders []DeckEntry
+	Sideboard  []DeckEntry
+}
+
+var (
+	deckLinePattern    = regexp.MustCompile(`^(\d+)x?\s+(.+)$`)
+	deckPrintPattern   = regexp.MustCompile(`^(.+?)\s+\(([A-Za-z0-9]+)\)(?:\s+(\S+))?$`)
+	deckMarkerPattern  = regexp.MustCompile(`\s+\*[A-Za-z]+\*$`)
+	deckSectionAliases = map[string]string{
+		"commander":   "commander",
+		"commanders":  "commander",
+		"deck":        "main",
+		"main":        "main",
+		"mainboard":   "main",
+		"sideboard":   "sideboard",
+		"side":        "sideboard",
+		"companion":   "sideboard",
+		"maybeboard":  "maybeboard",
+		"maybe":       "maybeboard",
+		"considering": "maybeboard",
+		"about":       "about",
+	}
+)
+
+// ParseDeckText reads lines like "1 Sol Ring" or "1 Sol Ring (C21) 263".
+// Commanders are taken from a "Commander" section or a "*CMDR*" marker.
+// Sideboards are either an explicit section, "SB:" prefixed lines, or, in
+// lists without section headers, everything after the first blank line.
+func ParseDeckText(text string) (*TextDeck, error) {
+	deck := &TextDeck{}
+	section := "main"
+	sawHeader := false
+	sawCards := false
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			if !sawHeader && sawCards {
+				section = "sideboard"
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "//") || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if alias, ok := deckSectionAliases[strings.ToLower(strings.TrimSuffix(line, ":"))]; ok {
+			section = alias
+			sawHeader = true
+			continue
+		}
+		if section == "about" {
+			continue
+		}
+
+		lineSection := section
+		if strings.HasPrefix(line, "SB:") {
+			lineSection = "sideboard"
+			line = strings.TrimSpace(strings.TrimPrefix(line, "SB:"))
+		}
+		entry := DeckEntry{Quantity: 1, Name: line}
+		if match := deckLinePattern.FindStringSubmatch(line); match != nil {
+			quantity, err := strconv.Atoi(match[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid quantity in line %q", line)
+			}
+			if quantity > maxCardQuantity {
+				return nil, fmt.Errorf("too many copies in line %q", line)
+			}
+			entry.Quantity = quantity
+			entry.Name = match[2]
+		}
+		for {
+			marker := deckMarkerPattern.FindString(entry.Name)
+			if marker == "" {
+				break
+			}
+			if strings.TrimSpace(marker) == "*CMDR*" {
+				lineSection = "commander"
+			}
+			entry.Name = strings.TrimSuffix(entry.Name, marker)
+		}
+		if match := deckPrintPattern.FindStringSubmatch(entry.Name); match != nil {
+			entry.Name = match[1]
+			entry.Set = match[2]
+			entry.CollectorNumber = match[3]
+		}
+		sawCards = true
+
+		switch lineSection {
+		case "commander":
+			deck.Commanders = append(deck.Commanders, entry)
+		case "sideboard":
+			deck.Sideboard = append(deck.Sideboard, entry)
+		case "main":
+			deck.Cards = append(deck.Cards, entry)
+		}
+	}
+	if len(deck.Cards) == 0 && len(deck.Commanders) == 0 {
+		return nil, errors.New("decklist is empty")
+	}
+	return deck, nil
+}
+
+func (d *TextDeck) cards() ([]Card, []Card, error) {
+	cards, err := entriesToCards(d.Cards)
+	if err != nil {
+		return nil, nil, err
+	}
+	commanders, err := entriesToCards(d.Commanders)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cards, commanders, nil
+}
+
+func entriesToCards(entries []DeckEntry) ([]Card, error) {
+	var cards []Card
+	for _, entry := range entries {
+		if err := checkQuantity(entry.Name, entry.Quantity, len(cards)); err != nil {
+			return nil, err
+		}
+		for i := 0; i < entry.Quantity; i++ {
+			card, err := newDeckCard(entry.Name, entry.Set, entry.CollectorNumber, "", "")
+			if err != nil {
+				return nil, err
+			}
+			cards = append(cards, card)
+		}
+	}
+	return cards, nil
+}
@@ -0,0 +1,83 @@
+package ws
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseDeckText(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want TextDeck
+	}{
+		{
+			name: "plain list",
+			text: "1 Sol Ring\n2x Island\n",
+			want: TextDeck{Cards: []DeckEntry{
+				{Quantity: 1, Name: "Sol Ring"},
+				{Quantity: 2, Name: "Island"},
+			}},
+		},
+		{
+			name: "printings",
+			text: "1 Sol Ring (C21) 263\n1 Arcane Signet (CMR)",
+			want: TextDeck{Cards: []DeckEntry{
+				{Quantity: 1, Name: "Sol Ring", Set: "C21", CollectorNumber: "263"},
+				{Quantity: 1, Name: "Arcane Signet", Set: "CMR"},
+			}},
+		},
+		{
+			name: "CMDR marker",
+			text: "1 Atraxa, Praetors' Voice *CMDR*\n1 Sol Ring (C21) 263 *F*",
+			want: TextDeck{
+				Cards:      []DeckEntry{{Quantity: 1, Name: "Sol Ring", Set: "C21", CollectorNumber: "263"}},
+				Commanders: []DeckEntry{{Quantity: 1, Name: "Atraxa, Praetors' Voice"}},
+			},
+		},
+		{
+			name: "SB lines",
+			text: "4 Lightning Bolt\nSB: 2 Pyroblast",
+			want: TextDeck{
+				Cards:     []DeckEntry{{Quantity: 4, Name: "Lightning Bolt"}},
+				Sideboard: []DeckEntry{{Quantity: 2, Name: "Pyroblast"}},
+			},
+		},
+		{
+			name: "sections",
+			text: "About\nName My Deck\n\nCommander\n1 Kenrith, the Returned King\n\nDeck\n1 Sol Ring\n// ramp\n1 Cultivate\n\nSideboard\n1 Negate\n\nMaybeboard\n1 Shock",
+			want: TextDeck{
+				Cards:      []DeckEntry{{Quantity: 1, Name: "Sol Ring"}, {Quantity: 1, Name: "Cultivate"}},
+				Commanders: []DeckEntry{{Quantity: 1, Name: "Kenrith, the Returned King"}},
+				Sideboard:  []DeckEntry{{Quantity: 1, Name: "Negate"}},
+			},
+		},
+		{
+			name: "blank line starts the sideboard without headers",
+			text: "60 Relentless Rats\n\n1 Negate",
+			want: TextDeck{
+				Cards:     []DeckEntry{{Quantity: 60, Name: "Relentless Rats"}},
+				Sideboard: []DeckEntry{{Quantity: 1, Name: "Negate"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deck, err := ParseDeckText(tt.text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(*deck, tt.want) {
+				t.Errorf("got %+v, want %+v", *deck, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDeckTextErrors(t *testing.T) {
+	for _, text := range []string{"", "// just a comment", "Sideboard\n1 Negate", "1000 Island"} {
+		if _, err := ParseDeckText(text); err == nil {
+			t.Errorf("expected an error for %q", text)
+		}
+	}
+}
@@ -6,4 +6,5 @@ type DiceRoller struct {
 	Y        float64 `json:"y"`
 	NumDice  int     `json:"numDice"`
 	NumSides int     `json:"numSides"`
+	Owner    string  `json:"owner"`
 }
@@ -0,0 +1,133 @@
+package ws
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	lethalPoison          = 10
+	lethalCommanderDamage = 21
+)
+
+// Reasons a player can be eliminated.
+const (
+	LossLife            = "life"
+	LossPoison          = "poison"
+	LossCommanderDamage = "commanderDamage"
+	LossEmptyLibrary    = "emptyLibrary"
+	LossConceded        = "conceded"
+)
+
+type Elimination struct {
+	Player string `json:"player"`
+	Reason string `json:"reason"`
+}
+
+// checkLosses eliminates those of the players who have met a loss condition
+// and returns who was eliminated. It runs for the players whose life, poison
+// or commander damage an action changed, whether by hand or through combat
+// damage. The caller must hold r.mu.
+func (r *Room) checkLosses(players []string) []Elimination {
+	var eliminated []Elimination
+	for _, player := range players {
+		if _, seated := r.PlayerPositions[player]; !seated {
+			continue
+		}
+		if reason := r.lossReason(player); reason != "" && r.eliminate(player, reason) {
+			eliminated = append(eliminated, Elimination{Player: player, Reason: reason})
+		}
+	}
+	return eliminated
+}
+
+func (r *Room) lossReason(player string) string {
+	if life, ok := r.LifeTotals[player]; ok && life <= 0 {
+		return LossLife
+	}
+	if r.Resources[player][ResourcePoison] >= lethalPoison {
+		return LossPoison
+	}
+	for _, damage := range r.CommanderDamage[player] {
+		if damage >= lethalCommanderDamage {
+			return LossCommanderDamage
+		}
+	}
+	return ""
+}
+
+// eliminate takes a player out of the game. They keep their seat and can
+// still watch, but the turn passes them by. The caller must hold r.mu.
+func (r *Room) eliminate(player string, reason string) bool {
+	if _, ok := r.Eliminated[player]; ok {
+		return false
+	}
+	r.Eliminated[player] = reason
+	if r.Hold == player {
+		r.Hold = ""
+	}
+	if r.Turn == player {
+		r.Turn = getNextTurn(r.PlayerPositions, r.Eliminated, r.Turn)
+		if r.Turn == player {
+			r.Turn = ""
+		}
+		r.TurnNumber++
+		r.Step = StepUntap
+		r.endCombat()
+	}
+	if r.Priority == player {
+		r.resetPriority(r.Turn)
+	}
+	return true
+}
+
+func (r *Room) remainingPlayers() []string {
+	var remaining []string
+	for player := range r.PlayerPositions {
+		if _, ok := r.Eliminated[player]; !ok {
+			remaining = append(remaining, player)
+		}
+	}
+	return remaining
+}
+
+// announceEliminations tells everyone who has been eliminated, and who won
+// once a single player is left.
+func (r *Room) announceEliminations(eliminations []Elimination) {
+	if len(eliminations) == 0 {
+		return
+	}
+	r.mu.Lock()
+	remaining := r.remainingPlayers()
+	turn := r.Turn
+	state := r.turnState()
+	r.mu.Unlock()
+	for _, elimination := range eliminations {
+		payload := map[string]interface{}{
+			"type":      "PLAYER_ELIMINATED",
+			"player":    elimination.Player,
+			"reason":    elimination.Reason,
+			"remaining": remaining,
+			"turn":      turn,
+		}
+		data, _ := json.Marshal(payload)
+		r.BroadcastSafe(data)
+	}
+	data, _ := json.Marshal(state)
+	r.BroadcastSafe(data)
+	if len(remaining) == 1 {
+		payload := map[string]interface{}{
+			"type":   "GAME_OVER",
+			"winner": remaining[0],
+		}
+		data, _ := json.Marshal(payload)
+		r.BroadcastSafe(data)
+	}
+}
+
+func (r *Room) isEliminated(player string) error {
+	if reason, ok := r.Eliminated[player]; ok {
+		return fmt.Errorf("you have been eliminated (%s)", reason)
+	}
+	return nil
+}
@@ -0,0 +1,684 @@
+package ws
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GameEvent is one entry of a room's append-only action log. Change holds the
+// state of every object the action touched, as it was after the action.
+type GameEvent struct {
+	Seq     int             `json:"seq"`
+	Actor   string          `json:"actor"`
+	Type    string          `json:"type"`
+	Time    time.Time       `json:"time"`
+	Message json.RawMessage `json:"message,omitempty"`
+	Change  StateChange     `json:"change"`
+}
+
+// StateChange is a diff between two flattened room states. Keys look like
+// "cards/<id>" or "hands/<username>"; see RoomSnapshot.entries.
+type StateChange struct {
+	Set     map[string]json.RawMessage `json:"set,omitempty"`
+	Removed []string                   `json:"removed,omitempty"`
+}
+
+func (c StateChange) isEmpty() bool {
+	return len(c.Set) == 0 && len(c.Removed) == 0
+}
+
+// redactFor hides what the viewer may not see from a change, for the event
+// log while the game is on.
+func (c StateChange) redactFor(viewer string) StateChange {
+	view := StateChange{Set: make(map[string]json.RawMessage, len(c.Set))}
+	for key, value := range c.Set {
+		if !libraryKey(key) {
+			view.Set[key] = redactEntry(key, value, viewer)
+		}
+	}
+	for _, key := range c.Removed {
+		if !libraryKey(key) {
+			view.Removed = append(view.Removed, key)
+		}
+	}
+	return view
+}
+
+func (c StateChange) applyTo(entries map[string]json.RawMessage) {
+	for key, value := range c.Set {
+		entries[key] = value
+	}
+	for _, key := range c.Removed {
+		delete(entries, key)
+	}
+}
+
+func diffEntries(before, after map[string]json.RawMessage) StateChange {
+	change := StateChange{Set: make(map[string]json.RawMessage)}
+	for key, value := range after {
+		if old, ok := before[key]; !ok || !bytes.Equal(old, value) {
+			change.Set[key] = value
+		}
+	}
+	for key := range before {
+		if _, ok := after[key]; !ok {
+			change.Removed = append(change.Removed, key)
+		}
+	}
+	sort.Strings(change.Removed)
+	return change
+}
+
+// entries flattens the snapshot into one JSON value per game object so that
+// consecutive states can be diffed. Resume tokens and the unrevealed seed are
+// deliberately left out; see copyPrivate.
+func (s *RoomSnapshot) entries() (map[string]json.RawMessage, error) {
+	entries := make(map[string]json.RawMessage)
+	for key, value := range map[string]interface{}{
+		"turn":       s.Turn,
+		"turnNumber": s.TurnNumber,
+		"step":       s.Step,
+		"stack":      s.Stack,
+		"priority":   s.Priority,
+		"hold":       s.Hold,
+	} {
+		data, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		entries[key] = data
+	}
+	for _, err := range []error{
+		addEntries(entries, "cards", s.Cards),
+		addEntries(entries, "deckUrls", s.DeckURLs),
+		addLibraryEntries(entries, s.Decks),
+		addEntries(entries, "positions", s.PlayerPositions),
+		addEntries(entries, "hands", s.Hands),
+		addEntries(entries, "lifeTotals", s.LifeTotals),
+		addEntries(entries, "resources", s.Resources),
+		addEntries(entries, "commanderDamage", s.CommanderDamage),
+		addEntries(entries, "designations", s.Designations),
+		addEntries(entries, "eliminated", s.Eliminated),
+		addEntries(entries, "turnOptions", s.TurnOptions),
+		addEntries(entries, "combat", s.Combat),
+		addEntries(entries, "priorityPasses", s.PriorityPasses),
+		addEntries(entries, "counters", s.Counters),
+		addEntries(entries, "arrows", s.Arrows),
+		addEntries(entries, "diceRollers", s.DiceRollers),
+		addEntries(entries, "zones", s.Zones),
+		addEntries(entries, "commanderCasts", s.CommanderCasts),
+		addEntries(entries, "seeds", seedsByEpoch(s.Seeds)),
+		addEntries(entries, "diceRolls", rollsByNonce(s.DiceRolls)),
+		addEntries(entries, "shuffles", shufflesByNonce(s.Shuffles)),
+	} {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+func seedsByEpoch(seeds []*SeedEpoch) map[string]*SeedEpoch {
+	byEpoch := make(map[string]*SeedEpoch, len(seeds))
+	for _, seed := range seeds {
+		byEpoch[strconv.Itoa(seed.Epoch)] = seed
+	}
+	return byEpoch
+}
+
+func shufflesByNonce(shuffles []ShuffleRecord) map[string]ShuffleRecord {
+	byNonce := make(map[string]ShuffleRecord, len(shuffles))
+	for _, shuffle := range shuffles {
+		byNonce[strconv.FormatUint(shuffle.Nonce, 10)] = shuffle
+	}
+	return byNonce
+}
+
+func rollsByNonce(rolls []DiceRoll) map[string]DiceRoll {
+	byNonce := make(map[string]DiceRoll, len(rolls))
+	for _, roll := range rolls {
+		byNonce[strconv.FormatUint(roll.Nonce, 10)] = roll
+	}
+	return byNonce
+}
+
+func snapshotFromEntries(id string, entries map[string]json.RawMessage) (*RoomSnapshot, error) {
+	snapshot := &RoomSnapshot{
+		ID:              id,
+		Cards:           make(map[string]*BoardCard),
+		DeckURLs:        make(map[string]string),
+		Decks:           make(map[string]*Deck),
+		PlayerPositions: make(map[string]string),
+		Hands:           make(map[string][]Card),
+		LifeTotals:      make(map[string]int),
+		Resources:       make(map[string]map[string]int),
+		CommanderDamage: make(map[string]map[string]int),
+		Designations:    make(map[string]string),
+		Eliminated:      make(map[string]string),
+		TurnOptions:     make(map[string]TurnOptions),
+		Combat:          make(map[string]*Attack),
+		PriorityPasses:  make(map[string]bool),
+		Counters:        make(map[string]*Counter),
+		Arrows:          make(map[string]*Arrow),
+		DiceRollers:     make(map[string]*DiceRoller),
+		Zones:           make(map[string]PlayerZones),
+		CommanderCasts:  make(map[string]int),
+		ResumeTokens:    make(map[string]string),
+	}
+	libraries := make(map[string]libraryEntry)
+	libraryCards := make(map[string]map[string]Card)
+	seeds := make(map[string]*SeedEpoch)
+	rolls := make(map[string]DiceRoll)
+	shuffles := make(map[string]ShuffleRecord)
+	for key, value := range entries {
+		var single interface{}
+		switch key {
+		case "turn":
+			single = &snapshot.Turn
+		case "turnNumber":
+			single = &snapshot.TurnNumber
+		case "step":
+			single = &snapshot.Step
+		case "stack":
+			single = &snapshot.Stack
+		case "priority":
+			single = &snapshot.Priority
+		case "hold":
+			single = &snapshot.Hold
+		}
+		if single != nil {
+			if err := json.Unmarshal(value, single); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		prefix, name, _ := strings.Cut(key, "/")
+		var err error
+		switch prefix {
+		case "cards":
+			err = setEntry(snapshot.Cards, name, value)
+		case "deckUrls":
+			err = setEntry(snapshot.DeckURLs, name, value)
+		case "decks":
+			err = setEntry(libraries, name, value)
+		case "library":
+			owner, id, _ := strings.Cut(name, "/")
+			if libraryCards[owner] == nil {
+				libraryCards[owner] = make(map[string]Card)
+			}
+			err = setEntry(libraryCards[owner], id, value)
+		case "positions":
+			err = setEntry(snapshot.PlayerPositions, name, value)
+		case "hands":
+			err = setEntry(snapshot.Hands, name, value)
+		case "lifeTotals":
+			err = setEntry(snapshot.LifeTotals, name, value)
+		case "resources":
+			err = setEntry(snapshot.Resources, name, value)
+		case "commanderDamage":
+			err = setEntry(snapshot.CommanderDamage, name, value)
+		case "designations":
+			err = setEntry(snapshot.Designations, name, value)
+		case "eliminated":
+			err = setEntry(snapshot.Eliminated, name, value)
+		case "turnOptions":
+			err = setEntry(snapshot.TurnOptions, name, value)
+		case "combat":
+			err = setEntry(snapshot.Combat, name, value)
+		case "priorityPasses":
+			err = setEntry(snapshot.PriorityPasses, name, value)
+		case "counters":
+			err = setEntry(snapshot.Counters, name, value)
+		case "arrows":
+			err = setEntry(snapshot.Arrows, name, value)
+		case "diceRollers":
+			err = setEntry(snapshot.DiceRollers, name, value)
+		case "zones":
+			err = setEntry(snapshot.Zones, name, value)
+		case "commanderCasts":
+			err = setEntry(snapshot.CommanderCasts, name, value)
+		case "seeds":
+			err = setEntry(seeds, name, value)
+		case "diceRolls":
+			err = setEntry(rolls, name, value)
+		case "shuffles":
+			err = setEntry(shuffles, name, value)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	for owner, entry := range libraries {
+		snapshot.Decks[owner] = entry.deck(libraryCards[owner])
+	}
+	for _, seed := range seeds {
+		snapshot.Seeds = append(snapshot.Seeds, seed)
+	}
+	sort.Slice(snapshot.Seeds, func(i, j int) bool {
+		return snapshot.Seeds[i].Epoch < snapshot.Seeds[j].Epoch
+	})
+	for _, roll := range rolls {
+		snapshot.DiceRolls = append(snapshot.DiceRolls, roll)
+	}
+	sort.Slice(snapshot.DiceRolls, func(i, j int) bool {
+		return snapshot.DiceRolls[i].Nonce < snapshot.DiceRolls[j].Nonce
+	})
+	for _, shuffle := range shuffles {
+		snapshot.Shuffles = append(snapshot.Shuffles, shuffle)
+	}
+	sort.Slice(snapshot.Shuffles, func(i, j int) bool {
+		return snapshot.Shuffles[i].Nonce < snapshot.Shuffles[j].Nonce
+	})
+	return snapshot, nil
+}
+
+// libraryEntry is a deck as the event log keeps it: the IDs of its cards in
+// order, with each card in its own "library/<owner>/<id>" entry, so that a
+// draw records the new order and the card that left rather than the whole
+// deck.
+type libraryEntry struct {
+	Deck
+	Order []string `json:"order"`
+}
+
+func addLibraryEntries(entries map[string]json.RawMessage, decks map[string]*Deck) error {
+	for owner, deck := range decks {
+		entry := libraryEntry{Deck: *deck, Order: make([]string, len(deck.Cards))}
+		entry.Cards = nil
+		for i, card := range deck.Cards {
+			entry.Order[i] = card.ID
+			data, err := json.Marshal(card)
+			if err != nil {
+				return err
+			}
+			entries["library/"+owner+"/"+card.ID] = data
+		}
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		entries["decks/"+owner] = data
+	}
+	return nil
+}
+
+// deck puts the library back together from its order and its cards. Cards
+// that are missing are left with only their ID, and hidden if that was
+// redacted too.
+func (e libraryEntry) deck(cards map[string]Card) *Deck {
+	deck := e.Deck
+	deck.Cards = make([]Card, len(e.Order))
+	for i, id := range e.Order {
+		card, ok := cards[id]
+		if !ok {
+			card = Card{ID: id, Hidden: id == ""}
+		}
+		deck.Cards[i] = card
+	}
+	return &deck
+}
+
+// redactFor blanks the IDs of the library cards the viewer does not know, so
+// they cannot be followed through a shuffle.
+func (e libraryEntry) redactFor(viewer string) libraryEntry {
+	deck := e.deck(nil)
+	redacted := e
+	redacted.Order = make([]string, len(e.Order))
+	redacted.Known = make(map[string]string)
+	for i, id := range e.Order {
+		if deck.visibleTo(i, viewer) {
+			redacted.Order[i] = id
+			redacted.Known[id] = e.Known[id]
+		}
+	}
+	return redacted
+}
+
+// libraryKey reports whether an entry holds a library card. The key itself
+// names the card, so these entries are left out of what players see while
+// the game is on; the deck entries stand in for them.
+func libraryKey(key string) bool {
+	return strings.HasPrefix(key, "library/")
+}
+
+func addEntries[V any](entries map[string]json.RawMessage, prefix string, m map[string]V) error {
+	for key, value := range m {
+		data, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		entries[prefix+"/"+key] = data
+	}
+	return nil
+}
+
+func setEntry[V any](m map[string]V, key string, data json.RawMessage) error {
+	var value V
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	m[key] = value
+	return nil
+}
+
+// redactEntry hides the cards in an entry that the viewer may not see, and
+// the library orders recorded by shuffles. An empty viewer sees only what is
+// public.
+func redactEntry(key string, value json.RawMessage, viewer string) json.RawMessage {
+	prefix, name, _ := strings.Cut(key, "/")
+	var redacted interface{}
+	switch prefix {
+	case "cards":
+		var card BoardCard
+		if json.Unmarshal(value, &card) != nil {
+			return value
+		}
+		redacted = boardCardFor(&card, viewer)
+	case "hands":
+		var hand []Card
+		if json.Unmarshal(value, &hand) != nil {
+			return value
+		}
+		redacted = cardsFor(hand, name, ZoneHand, viewer)
+	case "decks":
+		var entry libraryEntry
+		if json.Unmarshal(value, &entry) != nil {
+			return value
+		}
+		redacted = entry.redactFor(viewer)
+	case "zones":
+		var zones PlayerZones
+		if json.Unmarshal(value, &zones) != nil {
+			return value
+		}
+		for zone, cards := range zones {
+			zones[zone] = cardsFor(cards, name, zone, viewer)
+		}
+		redacted = zones
+	case "shuffles":
+		var shuffle ShuffleRecord
+		if json.Unmarshal(value, &shuffle) != nil {
+			return value
+		}
+		shuffle.Before = nil
+		shuffle.After = nil
+		redacted = shuffle
+	default:
+		return value
+	}
+	data, err := json.Marshal(redacted)
+	if err != nil {
+		return value
+	}
+	return data
+}
+
+// currentEntries flattens the room's state, or only the given entries when
+// keys is not nil. The caller must hold r.mu.
+func (r *Room) currentEntries(keys []string) (map[string]json.RawMessage, error) {
+	if keys == nil {
+		live := r.liveSnapshot()
+		return live.entries()
+	}
+	entries := make(map[string]json.RawMessage, len(keys))
+	for _, key := range keys {
+		prefix, id, _ := strings.Cut(key, "/")
+		var value interface{}
+		switch prefix {
+		case "cards":
+			if card, ok := r.Cards[id]; ok {
+				value = card
+			}
+		case "counters":
+			if counter, ok := r.Counters[id]; ok {
+				value = counter
+			}
+		case "diceRollers":
+			if diceRoller, ok := r.DiceRollers[id]; ok {
+				value = diceRoller
+			}
+		}
+		if value == nil {
+			continue
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		entries[key] = data
+	}
+	return entries, nil
+}
+
+// touchedEntries names the only entries an action can change, or returns nil
+// when that is not known up front. Moves are sent for every drag, so they are
+// recorded by comparing the objects they move rather than the whole room. The
+// caller must hold r.mu.
+func (r *Room) touchedEntries(msg Message) []string {
+	var keys []string
+	switch msg.Type {
+	case "MOVE_CARD", "MOVE_CARDS":
+		ids := []string{msg.ID}
+		if msg.Type == "MOVE_CARDS" {
+			ids = ids[:0]
+			for _, card := range msg.Cards {
+				ids = append(ids, card.ID)
+			}
+		}
+		for _, id := range ids {
+			keys = append(keys, "cards/"+id)
+			for _, attached := range r.attachments(id) {
+				keys = append(keys, "cards/"+attached.ID)
+			}
+		}
+	case "MOVE_COUNTER":
+		keys = append(keys, "counters/"+msg.ID)
+	case "MOVE_DICE_ROLLER":
+		keys = append(keys, "diceRollers/"+msg.ID)
+	}
+	return keys
+}
+
+// recordAction runs handle as a single action and appends whatever it
+// changed to the room's event log. Actions are serialized so that each event
+// only contains the changes made by its own actor. If touched is not nil, it
+// names the entries the action can change and only those are compared. It
+// returns the recorded event, if anything changed, along with the change that
+// would revert it.
+//
+// Messages the action sends are held until actionMu is released, so a slow
+// client never stalls the other players' actions, and are sent before
+// anything the next action says.
+func (r *Room) recordAction(actor string, actionType string, message []byte, touched func() []string, handle func()) (*GameEvent, StateChange) {
+	r.actionMu.Lock()
+	r.sendMu.Lock()
+	r.holding = true
+	r.sendMu.Unlock()
+
+	event, revert := r.record(actor, actionType, message, touched, handle)
+
+	r.sendMu.Lock()
+	r.actionMu.Unlock()
+	held := r.held
+	r.holding, r.held = false, nil
+	sendAll(held)
+	r.sendMu.Unlock()
+	return event, revert
+}
+
+// record does the work of recordAction. Every change to the room goes
+// through recordAction, so the state after one action is kept and used as the
+// state before the next rather than flattening the room again. The caller
+// must hold actionMu.
+func (r *Room) record(actor string, actionType string, message []byte, touched func() []string, handle func()) (*GameEvent, StateChange) {
+	r.mu.Lock()
+	var keys []string
+	if touched != nil {
+		keys = touched()
+	}
+	before := r.recorded
+	var err error
+	if keys != nil || before == nil {
+		before, err = r.currentEntries(keys)
+	}
+	r.mu.Unlock()
+	handle()
+	if err != nil {
+		log.Printf("error recording %s in room %s: %v", actionType, r.ID, err)
+		r.recorded = nil
+		return nil, StateChange{}
+	}
+	r.mu.Lock()
+	after, err := r.currentEntries(keys)
+	r.mu.Unlock()
+	if err != nil {
+		log.Printf("error recording %s in room %s: %v", actionType, r.ID, err)
+		r.recorded = nil
+		return nil, StateChange{}
+	}
+	if keys == nil {
+		r.recorded = after
+	} else if r.recorded != nil {
+		for _, key := range keys {
+			if value, ok := after[key]; ok {
+				r.recorded[key] = value
+			} else {
+				delete(r.recorded, key)
+			}
+		}
+	}
+	change := diffEntries(before, after)
+	if change.isEmpty() {
+		return nil, StateChange{}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	seq := 1
+	if len(r.Events) > 0 {
+		seq = r.Events[len(r.Events)-1].Seq + 1
+	}
+	event := GameEvent{
+		Seq:     seq,
+		Actor:   actor,
+		Type:    actionType,
+		Time:    time.Now(),
+		Message: message,
+		Change:  change,
+	}
+	r.Events = append(r.Events, event)
+	return &event, diffEntries(after, before)
+}
+
+// roomEvents returns the log of a running room, or of a finished one if the
+// hub has a store. live reports whether the game is still in progress.
+func (h *Hub) roomEvents(id string) (events []GameEvent, live bool, err error) {
+	h.Mu.Lock()
+	room, ok := h.Rooms[id]
+	h.Mu.Unlock()
+	if ok {
+		room.mu.Lock()
+		events = append([]GameEvent{}, room.Events...)
+		room.mu.Unlock()
+		return events, true, nil
+	}
+	if h.Store == nil {
+		return nil, false, nil
+	}
+	events, err = h.Store.LoadEvents(id)
+	return events, false, err
+}
+
+// ServeEventLog returns a room's action log. While the game is still being
+// played, hidden cards are redacted from it and the messages players sent are
+// left out.
+func ServeEventLog(hub *Hub, w http.ResponseWriter, r *http.Request) {
+	roomID := r.URL.Query().Get("room")
+	if roomID == "" {
+		http.Error(w, "Missing room ID", http.StatusBadRequest)
+		return
+	}
+	events, live, err := hub.roomEvents(roomID)
+	if err != nil {
+		log.Printf("error loading events for room %s: %v", roomID, err)
+		http.Error(w, "Failed to load events", http.StatusInternalServerError)
+		return
+	}
+	if len(events) == 0 {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+	if live {
+		for i := range events {
+			events[i].Change = events[i].Change.redactFor("")
+			// the message a player sent can name hidden cards, such as the
+			// card put on top of the library or the order chosen for a scry
+			events[i].Message = nil
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"room":   roomID,
+		"live":   live,
+		"events": events,
+	})
+}
+
+// ServeReplay rebuilds a room's state as it was right after event seq, or
+// after the latest event if seq is omitted.
+func ServeReplay(hub *Hub, w http.ResponseWriter, r *http.Request) {
+	roomID := r.URL.Query().Get("room")
+	if roomID == "" {
+		http.Error(w, "Missing room ID", http.StatusBadRequest)
+		return
+	}
+	events, live, err := hub.roomEvents(roomID)
+	if err != nil {
+		log.Printf("error loading events for room %s: %v", roomID, err)
+		http.Error(w, "Failed to load events", http.StatusInternalServerError)
+		return
+	}
+	if len(events) == 0 {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+	seq := events[len(events)-1].Seq
+	if seqString := r.URL.Query().Get("seq"); seqString != "" {
+		seq, err = strconv.Atoi(seqString)
+		if err != nil {
+			http.Error(w, "Invalid seq", http.StatusBadRequest)
+			return
+		}
+	}
+
+	entries := make(map[string]json.RawMessage)
+	for _, event := range events {
+		if event.Seq > seq {
+			break
+		}
+		event.Change.applyTo(entries)
+	}
+	if live {
+		for key, value := range entries {
+			entries[key] = redactEntry(key, value, "")
+		}
+	}
+	state, err := snapshotFromEntries(roomID, entries)
+	if err != nil {
+		log.Printf("error replaying room %s: %v", roomID, err)
+		http.Error(w, "Failed to replay room", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"room":  roomID,
+		"seq":   seq,
+		"state": state,
+	})
+}
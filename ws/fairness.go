@@ -0,0 +1,270 @@
+package ws
+
+import (
+	"crypto/hmac"
+	crand "crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Randomness in a room comes from a secret server seed. Its SHA-256 hash is
+// published as soon as the seed is created and the seed itself is revealed
+// later, on request or when the room closes, so anyone can recompute every
+// result drawn from it.
+//
+// Each draw uses its own nonce. The n-th random uint32 of a draw is read from
+// HMAC-SHA256(seed, "<purpose>:<nonce>:<block>") in 4-byte big-endian chunks,
+// eight per block, and values in [0, n) are taken by rejection sampling.
+
+// SeedEpoch is the public record of one server seed.
+type SeedEpoch struct {
+	Epoch      int    `json:"epoch"`
+	Commitment string `json:"commitment"`
+	Seed       string `json:"seed,omitempty"`
+}
+
+type DiceRoll struct {
+	Nonce    uint64    `json:"nonce"`
+	Epoch    int       `json:"epoch"`
+	RollerID string    `json:"rollerId"`
+	Player   string    `json:"player"`
+	NumDice  int       `json:"numDice"`
+	NumSides int       `json:"numSides"`
+	Results  []int     `json:"results"`
+	Time     time.Time `json:"time"`
+}
+
+const (
+	maxDice      = 100
+	maxDiceSides = 1000
+)
+
+func newSeed() (string, string, error) {
+	seed := make([]byte, 32)
+	if _, err := crand.Read(seed); err != nil {
+		return "", "", fmt.Errorf("error generating seed: %w", err)
+	}
+	commitment := sha256.Sum256(seed)
+	return hex.EncodeToString(seed), hex.EncodeToString(commitment[:]), nil
+}
+
+// startSeedEpoch commits to a fresh server seed. The caller must hold r.mu.
+func (r *Room) startSeedEpoch() error {
+	seed, commitment, err := newSeed()
+	if err != nil {
+		return err
+	}
+	r.SeedSecret = seed
+	r.Seeds = append(r.Seeds, &SeedEpoch{
+		Epoch:      len(r.Seeds) + 1,
+		Commitment: commitment,
+	})
+	return nil
+}
+
+// revealSeed publishes the current seed and commits to a new one. Every
+// library shuffle is drawn from the seed, so it is only revealed once the game
+// is over; see finish. The caller must hold r.mu.
+func (r *Room) revealSeed() (*SeedEpoch, error) {
+	if len(r.Seeds) == 0 {
+		return nil, errors.New("no seed to reveal")
+	}
+	current := r.Seeds[len(r.Seeds)-1]
+	current.Seed = r.SeedSecret
+	if err := r.startSeedEpoch(); err != nil {
+		return nil, err
+	}
+	return current, nil
+}
+
+func (r *Room) currentEpoch() int {
+	return r.Seeds[len(r.Seeds)-1].Epoch
+}
+
+// nextStream starts a new draw from the current seed. The caller must hold r.mu.
+func (r *Room) nextStream(purpose string) (*fairStream, uint64, error) {
+	if r.SeedSecret == "" {
+		if err := r.startSeedEpoch(); err != nil {
+			return nil, 0, err
+		}
+	}
+	r.Nonce++
+	stream, err := newFairStream(r.SeedSecret, purpose, r.Nonce)
+	return stream, r.Nonce, err
+}
+
+type fairStream struct {
+	seed   []byte
+	label  string
+	block  uint32
+	buffer []byte
+}
+
+func newFairStream(seedHex string, purpose string, nonce uint64) (*fairStream, error) {
+	seed, err := hex.DecodeString(seedHex)
+	if err != nil {
+		return nil, fmt.Errorf("invalid seed: %w", err)
+	}
+	return &fairStream{
+		seed:  seed,
+		label: fmt.Sprintf("%s:%d", purpose, nonce),
+	}, nil
+}
+
+func (s *fairStream) uint32() uint32 {
+	if len(s.buffer) < 4 {
+		mac := hmac.New(sha256.New, s.seed)
+		fmt.Fprintf(mac, "%s:%d", s.label, s.block)
+		s.buffer = mac.Sum(nil)
+		s.block++
+	}
+	value := binary.BigEndian.Uint32(s.buffer)
+	s.buffer = s.buffer[4:]
+	return value
+}
+
+// Intn returns a uniformly distributed value in [0, n).
+func (s *fairStream) Intn(n int) int {
+	limit := uint32(1<<32 - (1<<32)%uint64(n))
+	for {
+		value := s.uint32()
+		if limit == 0 || value < limit {
+			return int(value % uint32(n))
+		}
+	}
+}
+
+func rollResults(stream *fairStream, numDice, numSides int) []int {
+	results := make([]int, numDice)
+	for i := range results {
+		results[i] = stream.Intn(numSides) + 1
+	}
+	return results
+}
+
+// rollDice rolls a dice roller and adds the roll to the room history. The
+// caller must hold r.mu.
+func (r *Room) rollDice(username string, rollerID string) (DiceRoll, error) {
+	roller, ok := r.DiceRollers[rollerID]
+	if !ok {
+		return DiceRoll{}, errors.New("dice roller not found")
+	}
+	if roller.NumDice < 1 || roller.NumDice > maxDice || roller.NumSides < 2 || roller.NumSides > maxDiceSides {
+		return DiceRoll{}, errors.New("invalid dice roller")
+	}
+	stream, nonce, err := r.nextStream("dice")
+	if err != nil {
+		return DiceRoll{}, err
+	}
+	roll := DiceRoll{
+		Nonce:    nonce,
+		Epoch:    r.currentEpoch(),
+		RollerID: roller.ID,
+		Player:   username,
+		NumDice:  roller.NumDice,
+		NumSides: roller.NumSides,
+		Results:  rollResults(stream, roller.NumDice, roller.NumSides),
+		Time:     time.Now(),
+	}
+	r.DiceRolls = append(r.DiceRolls, roll)
+	return roll, nil
+}
+
+// VerifyDiceRoll recomputes a roll from its revealed seed.
+func VerifyDiceRoll(seedHex string, roll DiceRoll) bool {
+	stream, err := newFairStream(seedHex, "dice", roll.Nonce)
+	if err != nil {
+		return false
+	}
+	results := rollResults(stream, roll.NumDice, roll.NumSides)
+	if len(results) != len(roll.Results) {
+		return false
+	}
+	for i := range results {
+		if results[i] != roll.Results[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// VerifySeed checks a revealed seed against the commitment published for it.
+func VerifySeed(epoch SeedEpoch) bool {
+	seed, err := hex.DecodeString(epoch.Seed)
+	if err != nil {
+		return false
+	}
+	commitment := sha256.Sum256(seed)
+	return hex.EncodeToString(commitment[:]) == epoch.Commitment
+}
+
+// ShuffleRecord is the audit trail of one library shuffle: the library order,
+// by card ID, before and after.
+type ShuffleRecord struct {
+	Nonce  uint64    `json:"nonce"`
+	Epoch  int       `json:"epoch"`
+	Deck   string    `json:"deck"`
+	Before []string  `json:"before,omitempty"`
+	After  []string  `json:"after,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+// shuffleOrder is a Fisher-Yates shuffle driven by the seeded stream.
+func shuffleOrder(stream *fairStream, n int, swap func(i, j int)) {
+	for i := n - 1; i > 0; i-- {
+		swap(i, stream.Intn(i+1))
+	}
+}
+
+// shuffleLibrary shuffles a player's library and records the shuffle. The
+// caller must hold r.mu.
+func (r *Room) shuffleLibrary(owner string) (ShuffleRecord, error) {
+	deck, ok := r.Decks[owner]
+	if !ok {
+		return ShuffleRecord{}, errors.New("player has no library")
+	}
+	stream, nonce, err := r.nextStream("shuffle")
+	if err != nil {
+		return ShuffleRecord{}, err
+	}
+	before := cardIDs(deck.Cards)
+	shuffleOrder(stream, len(deck.Cards), func(i, j int) {
+		deck.Cards[i], deck.Cards[j] = deck.Cards[j], deck.Cards[i]
+	})
+	deck.Known = nil
+	shuffle := ShuffleRecord{
+		Nonce:  nonce,
+		Epoch:  r.currentEpoch(),
+		Deck:   owner,
+		Before: before,
+		After:  cardIDs(deck.Cards),
+		Time:   time.Now(),
+	}
+	r.Shuffles = append(r.Shuffles, shuffle)
+	return shuffle, nil
+}
+
+func cardIDs(cards []Card) []string {
+	ids := make([]string, len(cards))
+	for i, card := range cards {
+		ids[i] = card.ID
+	}
+	return ids
+}
+
+// VerifyShuffle re-runs a shuffle from its revealed seed.
+func VerifyShuffle(seedHex string, shuffle ShuffleRecord) bool {
+	stream, err := newFairStream(seedHex, "shuffle", shuffle.Nonce)
+	if err != nil {
+		return false
+	}
+	order := append([]string{}, shuffle.Before...)
+	shuffleOrder(stream, len(order), func(i, j int) {
+		order[i], order[j] = order[j], order[i]
+	})
+	return sameOrder(order, shuffle.After)
+}
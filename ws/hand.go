@@ -0,0 +1,64 @@
+package ws
+
+import "errors"
+
+// handSizes is the only view of the hands that is shared with everyone;
+// the cards themselves are only ever sent to the hand's owner.
+func (r *Room) handSizes() map[string]int {
+	sizes := make(map[string]int, len(r.Hands))
+	for username, hand := range r.Hands {
+		sizes[username] = len(hand)
+	}
+	return sizes
+}
+
+func (r *Room) addToHand(username string, card Card) {
+	r.Hands[username] = append(r.Hands[username], card)
+}
+
+func (r *Room) takeFromHand(username string, cardID string) (Card, bool) {
+	hand := r.Hands[username]
+	for i, card := range hand {
+		if card.ID == cardID {
+			r.Hands[username] = append(hand[:i:i], hand[i+1:]...)
+			return card, true
+		}
+	}
+	return Card{}, false
+}
+
+var errEmptyLibrary = errors.New("library is empty")
+
+// drawCard moves the top card of a player's library into their hand.
+func (r *Room) drawCard(username string) (Card, error) {
+	deck, ok := r.Decks[username]
+	if !ok {
+		return Card{}, errors.New("player has no library")
+	}
+	if len(deck.Cards) == 0 {
+		return Card{}, errEmptyLibrary
+	}
+	card := deck.takeTop(1)[0]
+	r.addToHand(username, card)
+	return card, nil
+}
+
+// announceDraw shows the drawn card to the player who drew it and only the
+// new hand size to everyone else.
+func (r *Room) announceDraw(username string, card Card) {
+	r.BroadcastEach(func(viewer string) interface{} {
+		handSize := len(r.Hands[username])
+		if viewer == username {
+			return map[string]interface{}{
+				"type":     "CARD_DRAWN",
+				"card":     card,
+				"handSize": handSize,
+			}
+		}
+		return map[string]interface{}{
+			"type":     "PLAYER_DREW_CARD",
+			"player":   username,
+			"handSize": handSize,
+		}
+	})
+}
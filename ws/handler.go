@@ -22,6 +22,8 @@ func ServeWebSocket(hub *Hub, w http.ResponseWriter, r *http.Request) {
 	username := r.URL.Query().Get("username")
 	spectatorString := r.URL.Query().Get("spectator")
 	deckUrl := r.URL.Query().Get("deckUrl")
+	deckList := r.URL.Query().Get("deckList")
+	resumeToken := r.URL.Query().Get("resumeToken")
 	spectator, _ := strconv.ParseBool(spectatorString)
 
 	if roomID == "" {
@@ -34,12 +36,14 @@ func ServeWebSocket(hub *Hub, w http.ResponseWriter, r *http.Request) {
 	}
 	room := hub.GetOrCreateRoom(roomID)
 	client := &Client{
-		Conn:      conn,
-		Send:      make(chan []byte, 16),
-		Room:      room,
-		Username:  username,
-		Spectator: spectator,
-		DeckUrl:   deckUrl,
+		Conn:        conn,
+		Send:        make(chan []byte, 16),
+		Room:        room,
+		Username:    username,
+		Spectator:   spectator,
+		DeckUrl:     deckUrl,
+		DeckList:    deckList,
+		ResumeToken: resumeToken,
 	}
 	if room.Turn == "" {
 		room.Turn = username
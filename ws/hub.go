@@ -3,16 +3,24 @@ package ws
 import (
 	"log"
 	"sync"
+	"time"
 )
 
 type Hub struct {
-	Rooms map[string]*Room
-	Mu    sync.Mutex
+	Rooms          map[string]*Room
+	Mu             sync.Mutex
+	ReconnectGrace time.Duration
+	UndoDepth      int
+	StartingLife   int
+	Store          RoomStore
 }
 
 func NewHub() *Hub {
 	return &Hub{
-		Rooms: make(map[string]*Room),
+		Rooms:          make(map[string]*Room),
+		ReconnectGrace: defaultReconnectGrace,
+		UndoDepth:      defaultUndoDepth,
+		StartingLife:   defaultStartingLife,
 	}
 }
 
@@ -22,16 +30,70 @@ func (h *Hub) GetOrCreateRoom(id string) *Room {
 
 	room, exists := h.Rooms[id]
 	if !exists {
-		room = NewRoom(id)
+		room = h.newRoom(id)
 		h.Rooms[id] = room
+		h.runRoom(room)
+	}
+	return room
+}
 
-		go func() {
-			room.Run()
-			h.Mu.Lock()
-			delete(h.Rooms, id)
-			h.Mu.Unlock()
-			log.Printf("Room %s deleted", id)
-		}()
+// LoadRooms restores every room saved in the store. Restored players show up
+// as disconnected and keep their seats for the reconnect grace period.
+func (h *Hub) LoadRooms() error {
+	if h.Store == nil {
+		return nil
 	}
+	snapshots, err := h.Store.LoadRooms()
+	if err != nil {
+		return err
+	}
+	h.Mu.Lock()
+	defer h.Mu.Unlock()
+	for _, snapshot := range snapshots {
+		if len(snapshot.PlayerPositions) == 0 {
+			h.Store.DeleteRoom(snapshot.ID)
+			continue
+		}
+		room := h.newRoom(snapshot.ID)
+		room.restore(snapshot)
+		events, err := h.Store.LoadEvents(snapshot.ID)
+		if err != nil {
+			log.Printf("error loading events for room %s: %v", snapshot.ID, err)
+		}
+		room.Events = events
+		room.persistedEvents = len(events)
+		now := time.Now()
+		for username := range room.PlayerPositions {
+			room.Disconnected[username] = now
+			room.scheduleExpiry(username)
+		}
+		h.Rooms[snapshot.ID] = room
+		h.runRoom(room)
+		log.Printf("Room %s restored", snapshot.ID)
+	}
+	return nil
+}
+
+func (h *Hub) newRoom(id string) *Room {
+	room := NewRoom(id)
+	room.ReconnectGrace = h.ReconnectGrace
+	room.UndoDepth = h.UndoDepth
+	room.StartingLife = h.StartingLife
+	room.Store = h.Store
 	return room
 }
+
+func (h *Hub) runRoom(room *Room) {
+	go func() {
+		room.Run()
+		h.Mu.Lock()
+		delete(h.Rooms, room.ID)
+		h.Mu.Unlock()
+		if h.Store != nil {
+			if err := h.Store.DeleteRoom(room.ID); err != nil {
+				log.Printf("error deleting room %s: %v", room.ID, err)
+			}
+		}
+		log.Printf("Room %s deleted", room.ID)
+	}()
+}
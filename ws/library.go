@@ -0,0 +1,162 @@
+package ws
+
+import "sort"
+
+// Who, besides the server, knows a library card's identity and position.
+const (
+	KnownPublic = "public"
+	KnownOwner  = "owner"
+)
+
+// KnownCard is a library card a viewer is allowed to see, with its position
+// counted from the top of the library.
+type KnownCard struct {
+	Position int  `json:"position"`
+	Card     Card `json:"card"`
+}
+
+// LibraryView is what clients are sent instead of a Deck: the library order
+// never leaves the server, only its size and the cards a viewer already knows.
+type LibraryView struct {
+	ID          string      `json:"id"`
+	X           float64     `json:"x"`
+	Y           float64     `json:"y"`
+	Count       int         `json:"count"`
+	Commanders  []Card      `json:"commanders"`
+	Known       []KnownCard `json:"known"`
+	TopRevealed bool        `json:"topRevealed,omitempty"`
+}
+
+func (d *Deck) viewFor(viewer string) LibraryView {
+	view := LibraryView{
+		ID:          d.ID,
+		X:           d.X,
+		Y:           d.Y,
+		Count:       len(d.Cards),
+		Commanders:  d.Commanders,
+		Known:       []KnownCard{},
+		TopRevealed: d.TopRevealed,
+	}
+	for i, card := range d.Cards {
+		if d.visibleTo(i, viewer) {
+			view.Known = append(view.Known, KnownCard{Position: i, Card: card})
+		}
+	}
+	return view
+}
+
+func (d *Deck) visibleTo(position int, viewer string) bool {
+	if position == 0 && d.TopRevealed {
+		return true
+	}
+	known := d.Known[d.Cards[position].ID]
+	return known == KnownPublic || (known == KnownOwner && viewer == d.ID)
+}
+
+// redactFor hides the library cards the viewer does not know, keeping their
+// count, for the event log and undo.
+func (d *Deck) redactFor(viewer string) Deck {
+	redacted := *d
+	redacted.Cards = make([]Card, len(d.Cards))
+	redacted.Known = make(map[string]string)
+	for i, card := range d.Cards {
+		if d.visibleTo(i, viewer) {
+			redacted.Cards[i] = card
+			redacted.Known[card.ID] = d.Known[card.ID]
+		} else {
+			redacted.Cards[i] = Card{Hidden: true}
+		}
+	}
+	return redacted
+}
+
+// librariesFor returns every player's library as the viewer is allowed to see it.
+func (r *Room) librariesFor(viewer string) map[string]LibraryView {
+	views := make(map[string]LibraryView, len(r.Decks))
+	for owner, deck := range r.Decks {
+		views[owner] = deck.viewFor(viewer)
+	}
+	return views
+}
+
+func (r *Room) libraryFor(owner string, viewer string) *LibraryView {
+	deck, ok := r.Decks[owner]
+	if !ok {
+		return nil
+	}
+	view := deck.viewFor(viewer)
+	return &view
+}
+
+func (d *Deck) know(cardID string, known string) {
+	if known == "" {
+		return
+	}
+	if d.Known == nil {
+		d.Known = make(map[string]string)
+	}
+	d.Known[cardID] = known
+}
+
+func (d *Deck) putOnTop(card Card, known string) {
+	d.Cards = append([]Card{card}, d.Cards...)
+	d.know(card.ID, known)
+}
+
+func (d *Deck) putOnBottom(card Card, known string) {
+	d.Cards = append(d.Cards, card)
+	d.know(card.ID, known)
+}
+
+// peekTop returns up to n cards from the top of the library.
+func (d *Deck) peekTop(n int) []Card {
+	if n > len(d.Cards) {
+		n = len(d.Cards)
+	}
+	if n < 0 {
+		n = 0
+	}
+	return append([]Card{}, d.Cards[:n]...)
+}
+
+func (d *Deck) takeTop(n int) []Card {
+	taken := d.peekTop(n)
+	d.Cards = d.Cards[len(taken):]
+	for _, card := range taken {
+		delete(d.Known, card.ID)
+	}
+	return taken
+}
+
+func (d *Deck) take(cardID string) (Card, bool) {
+	for i, card := range d.Cards {
+		if card.ID == cardID {
+			d.Cards = append(d.Cards[:i:i], d.Cards[i+1:]...)
+			delete(d.Known, cardID)
+			return card, true
+		}
+	}
+	return Card{}, false
+}
+
+// searchOrder lists the library for a player searching it, sorted by name so
+// that the search itself gives nothing away about the order.
+func (d *Deck) searchOrder() []Card {
+	cards := append([]Card{}, d.Cards...)
+	sort.SliceStable(cards, func(i, j int) bool {
+		return cards[i].Name < cards[j].Name
+	})
+	return cards
+}
+
+// knownFrom is how well known a card put into a library is, given the zone it
+// came from.
+func knownFrom(source string) string {
+	switch source {
+	case ZoneHand, ZoneExileFaceDown:
+		return KnownOwner
+	case ZoneLibrary:
+		return ""
+	}
+	return KnownPublic
+}
@@ -7,20 +7,43 @@ type Message struct {
 	X         float64 `json:"x,omitempty"`
 	Y         float64 `json:"y,omitempty"`
 	Tapped    bool    `json:"tapped,omitempty"`
+	Revealed  bool    `json:"revealed,omitempty"`
+	FaceDown  bool    `json:"faceDown,omitempty"`
 	FlipIndex int     `json:"flipIndex,omitempty"`
 
-	Username  string `json:"username,omitempty"`
-	DeckURL   string `json:"deckUrl,omitempty"`
-	LifeTotal *int   `json:"lifeTotal,omitempty"` // pointer so 0 is distinguishable from missing
+	Username  string   `json:"username,omitempty"`
+	Players   []string `json:"players,omitempty"`
+	DeckURL   string   `json:"deckUrl,omitempty"`
+	LifeTotal *int     `json:"lifeTotal,omitempty"` // pointer so 0 is distinguishable from missing
 
 	Cards []BoardCard `json:"cards,omitempty"`
 	Card  BoardCard   `json:"card,omitempty"`
-	Deck  Deck        `json:"deck,omitempty"`
 
-	Source string `json:"source,omitempty"`
+	Source  string `json:"source,omitempty"`
+	Zone    string `json:"zone,omitempty"`
+	TokenID string `json:"tokenId,omitempty"`
+	Host    string `json:"host,omitempty"`
+	Text    string `json:"text,omitempty"`
 
 	Counters []Counter `json:"counters,omitempty"` // this should be a dictionary?
 	Count    int       `json:"count,omitempty"`
+	Kind     string    `json:"kind,omitempty"`
+
+	Step      string   `json:"step,omitempty"`
+	AutoUntap bool     `json:"autoUntap,omitempty"`
+	AutoDraw  bool     `json:"autoDraw,omitempty"`
+	Steps     []string `json:"steps,omitempty"`
+
+	Attacks []Attack           `json:"attacks,omitempty"`
+	Blocks  []Block            `json:"blocks,omitempty"`
+	Damage  []DamageAssignment `json:"damage,omitempty"`
+
+	Surveil   bool     `json:"surveil,omitempty"`
+	Top       []string `json:"top,omitempty"`
+	Bottom    []string `json:"bottom,omitempty"`
+	Graveyard []string `json:"graveyard,omitempty"`
+
+	Arrow Arrow `json:"arrow,omitempty"`
 
 	DiceRoller  []DiceRoller `json:"diceRollers,omitempty"` // this should be a dictionary?
 	DiceResults []int        `json:"diceResults,omitempty"`
@@ -0,0 +1,84 @@
+package ws
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+)
+
+type MoxfieldSource struct {
+	APIBase string
+}
+
+func (s *MoxfieldSource) Matches(deckURL *url.URL) bool {
+	return hostMatches(deckURL, "moxfield.com")
+}
+
+func (s *MoxfieldSource) FetchDeck(deckURL string) ([]Card, []Card, error) {
+	deckID, err := deckPathID(deckURL, "decks")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch deck: %w", err)
+	}
+	data, err := fetchURL(fmt.Sprintf("%s/decks/all/%s", s.APIBase, deckID))
+	if err != nil {
+		return nil, nil, err
+	}
+	return ParseMoxfieldDeck(data)
+}
+
+type moxfieldBoard struct {
+	Cards map[string]struct {
+		Quantity int `json:"quantity"`
+		Card     struct {
+			Name       string `json:"name"`
+			Set        string `json:"set"`
+			CN         string `json:"cn"`
+			ScryfallID string `json:"scryfall_id"`
+			Layout     string `json:"layout"`
+		} `json:"card"`
+	} `json:"cards"`
+}
+
+// ParseMoxfieldDeck reads the JSON returned by Moxfield's deck API. Only the
+// mainboard and commanders are used; sideboard and maybeboard are skipped.
+func ParseMoxfieldDeck(data []byte) ([]Card, []Card, error) {
+	var parsed struct {
+		Boards map[string]moxfieldBoard `json:"boards"`
+	}
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return nil, nil, fmt.Errorf("error unmarshaling deck JSON: %w", err)
+	}
+	cards, err := parsed.Boards["mainboard"].deckCards()
+	if err != nil {
+		return nil, nil, err
+	}
+	commanders, err := parsed.Boards["commanders"].deckCards()
+	if err != nil {
+		return nil, nil, err
+	}
+	return cards, commanders, nil
+}
+
+func (b moxfieldBoard) deckCards() ([]Card, error) {
+	keys := make([]string, 0, len(b.Cards))
+	for key := range b.Cards {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var cards []Card
+	for _, key := range keys {
+		entry := b.Cards[key]
+		if err := checkQuantity(entry.Card.Name, entry.Quantity, len(cards)); err != nil {
+			return nil, err
+		}
+		for i := 0; i < entry.Quantity; i++ {
+			card, err := newDeckCard(entry.Card.Name, entry.Card.Set, entry.Card.CN, entry.Card.Layout, entry.Card.ScryfallID)
+			if err != nil {
+				return nil, err
+			}
+			cards = append(cards, card)
+		}
+	}
+	return cards, nil
+}
@@ -0,0 +1,269 @@
+package ws
+
+import (
+	"errors"
+	"fmt"
+)
+
+// authorize decides whether a client may perform an action. Only seated
+// players may act at all; beyond that an action may be limited to the
+// active player, to the player whose hand or library it touches, to the
+// controller of the cards it targets, or to the owner of the counters,
+// arrows and dice rollers it targets. The caller must hold r.mu.
+func (r *Room) authorize(c *Client, msg Message) error {
+	if c.Spectator {
+		return errors.New("spectators cannot take actions")
+	}
+	if !r.Clients[c] {
+		// a second connection under a seated player's name that the room
+		// turned away
+		return errors.New("you are not connected to this room")
+	}
+	if _, ok := r.PlayerPositions[c.Username]; !ok {
+		return errors.New("you are not seated in this room")
+	}
+	if err := r.isEliminated(c.Username); err != nil {
+		return err
+	}
+
+	switch msg.Type {
+	case "PASS_TURN", "ADVANCE_PHASE":
+		if r.Turn != "" && r.Turn != c.Username {
+			return errors.New("only the active player can move the turn on")
+		}
+		return r.isHeld(c.Username)
+
+	case "DECLARE_ATTACKERS":
+		if r.Turn != "" && r.Turn != c.Username {
+			return errors.New("only the active player can attack")
+		}
+
+	case "SET_PHASE":
+		if r.Turn != c.Username {
+			return errors.New("only the active player can move the turn on")
+		}
+		if !isStep(msg.Step) {
+			return errors.New("unknown step: " + msg.Step)
+		}
+		return r.isHeld(c.Username)
+
+	case "CARD_TO_TOP_OF_DECK", "CARD_TO_BOTTOM_OF_DECK", "CARD_TO_SHUFFLE_IN_DECK":
+		if msg.Source == ZoneBoard {
+			return r.canMoveToOwner(c.Username, msg.Card.ID, msg.Username)
+		}
+		return r.isSelf(c.Username, msg.Username)
+
+	case "CARDS_TO_TOP_OF_DECK", "CARDS_TO_BOTTOM_OF_DECK", "CARDS_TO_SHUFFLE_IN_DECK", "RETURN_CARDS_TO_HAND":
+		for _, card := range msg.Cards {
+			if err := r.canMoveToOwner(c.Username, card.ID, msg.Username); err != nil {
+				return err
+			}
+		}
+
+	case "RETURN_TO_HAND":
+		return r.canMoveToOwner(c.Username, msg.ID, msg.Username)
+
+	case "CARD_PLAYED_FROM_LIBRARY", "TUTOR_TO_HAND":
+		return r.isSelf(c.Username, msg.Username)
+
+	case "SHUFFLE_DECK":
+		return r.isSelf(c.Username, msg.ID)
+
+	case "LIFE_TOTAL_CHANGE", "MILL", "ADD_PLAYER_RESOURCE", "SET_PLAYER_RESOURCE",
+		"ADD_COMMANDER_DAMAGE", "SET_COMMANDER_DAMAGE":
+		if _, ok := r.PlayerPositions[msg.Username]; !ok {
+			return fmt.Errorf("%q is not a player in this room", msg.Username)
+		}
+
+	case "SPAWN_TOKEN":
+		if _, exists := r.Cards[msg.Card.ID]; exists || msg.Card.ID == "" {
+			return errors.New("tokens need a new card id")
+		}
+		return r.isSelf(c.Username, msg.Card.Owner)
+
+	case "DELETE_TOKEN":
+		card, err := r.controlledCard(c.Username, msg.ID)
+		if err != nil {
+			return err
+		}
+		if !card.Token {
+			return errors.New("only tokens can be deleted")
+		}
+
+	case "TAP_CARD", "FLIP_CARD", "MOVE_CARD", "SET_FACE_DOWN", "ATTACH_CARD", "DETACH_CARD":
+		_, err := r.controlledCard(c.Username, msg.ID)
+		return err
+
+	case "TAP_CARDS", "MOVE_CARDS":
+		for _, card := range msg.Cards {
+			if _, err := r.controlledCard(c.Username, card.ID); err != nil {
+				return err
+			}
+		}
+
+	case "MOVE_TO_ZONE":
+		if msg.Source == ZoneBoard {
+			_, err := r.controlledCard(c.Username, msg.ID)
+			return err
+		}
+		return r.isSelf(c.Username, msg.Username)
+
+	case "ADD_CARD_COUNTER", "SET_CARD_COUNTER":
+		// counters often go on other players' permanents
+		if _, ok := r.Cards[msg.ID]; !ok {
+			return errors.New("card is not on the board")
+		}
+
+	case "GAIN_CONTROL":
+		card, ok := r.Cards[msg.ID]
+		if !ok {
+			return errors.New("card is not on the board")
+		}
+		if card.controlledBy() == c.Username {
+			return errors.New("you already control that card")
+		}
+
+	case "RETURN_CONTROL":
+		card, ok := r.Cards[msg.ID]
+		if !ok {
+			return errors.New("card is not on the board")
+		}
+		if card.controlledBy() != c.Username && card.Owner != c.Username {
+			return errors.New("you neither own nor control that card")
+		}
+
+	case "REVEAL_CARD", "LOOK_AT_CARD":
+		if msg.Source == ZoneBoard {
+			_, err := r.controlledCard(c.Username, msg.ID)
+			return err
+		}
+		return r.isSelf(c.Username, msg.Username)
+
+	case "PASS_PRIORITY":
+		if r.Priority != c.Username {
+			return errors.New("you do not have priority")
+		}
+
+	case "SET_AUTO_YIELD":
+		for _, step := range msg.Steps {
+			if !isStep(step) {
+				return errors.New("unknown step: " + step)
+			}
+		}
+
+	case "RESOLVE_TOP":
+		if len(r.Stack) == 0 {
+			return errors.New("the stack is empty")
+		}
+		if r.Priority != "" {
+			return errors.New("the top of the stack resolves once every player has passed priority")
+		}
+		if top := r.Stack[len(r.Stack)-1]; top.Controller != c.Username && r.Turn != c.Username {
+			return errors.New("only the active player or the controller of the top of the stack can resolve it")
+		}
+
+	case "COUNTER_TOP":
+		if len(r.Stack) == 0 {
+			return errors.New("the stack is empty")
+		}
+		if r.Priority != "" {
+			if r.Priority != c.Username {
+				return errors.New("you do not have priority")
+			}
+		} else if top := r.Stack[len(r.Stack)-1]; top.Controller == c.Username {
+			return errors.New("only an opponent of its controller can counter the top of the stack")
+		}
+
+	case "DELETE_ARROW":
+		arrow, ok := r.Arrows[msg.ID]
+		if !ok {
+			return errors.New("arrow not found")
+		}
+		return r.isSelf(c.Username, arrow.Owner)
+
+	case "ADD_COUNTER":
+		if len(msg.Counters) == 0 {
+			return errors.New("no counter given")
+		}
+		if _, exists := r.Counters[msg.Counters[0].ID]; exists || msg.Counters[0].ID == "" {
+			return errors.New("counters need a new id")
+		}
+		return r.isSelf(c.Username, msg.Counters[0].Owner)
+
+	case "MOVE_COUNTER", "UPDATE_COUNTER", "DELETE_COUNTER":
+		counter, ok := r.Counters[msg.ID]
+		if !ok {
+			return errors.New("counter not found")
+		}
+		return r.isSelf(c.Username, counter.Owner)
+
+	case "ADD_DICE_ROLLER":
+		if len(msg.DiceRoller) == 0 {
+			return errors.New("no dice roller given")
+		}
+		if _, exists := r.DiceRollers[msg.DiceRoller[0].ID]; exists || msg.DiceRoller[0].ID == "" {
+			return errors.New("dice rollers need a new id")
+		}
+
+	case "MOVE_DICE_ROLLER", "DELETE_DICE_ROLLER":
+		roller, ok := r.DiceRollers[msg.ID]
+		if !ok {
+			return errors.New("dice roller not found")
+		}
+		if roller.Owner == "" {
+			// rollers created before they had owners are shared
+			return nil
+		}
+		return r.isSelf(c.Username, roller.Owner)
+	}
+	return nil
+}
+
+func (r *Room) isSelf(username string, target string) error {
+	if target != username {
+		return errors.New("that belongs to another player")
+	}
+	return nil
+}
+
+// isHeld stops the active player moving on while another player has asked
+// them to hold.
+func (r *Room) isHeld(username string) error {
+	if r.Hold != "" && r.Hold != username {
+		return fmt.Errorf("%s has asked everyone to hold", r.Hold)
+	}
+	return nil
+}
+
+func (r *Room) controlledCard(username string, cardID string) (*BoardCard, error) {
+	card, ok := r.Cards[cardID]
+	if !ok {
+		return nil, errors.New("card is not on the board")
+	}
+	if card.controlledBy() != username {
+		return nil, errors.New("you do not control that card")
+	}
+	return card, nil
+}
+
+// canMoveToOwner checks a board card is the player's to move, and that it is
+// going to its owner's hand or library.
+func (r *Room) canMoveToOwner(username string, cardID string, owner string) error {
+	card, err := r.controlledCard(username, cardID)
+	if err != nil {
+		return err
+	}
+	if card.Owner != owner {
+		return errors.New("cards can only go to their owner's hand or library")
+	}
+	return nil
+}
+
+func (c *Client) refuse(action string, err error) {
+	c.sendJSON(map[string]interface{}{
+		"type":   "ERROR",
+		"error":  "FORBIDDEN",
+		"action": action,
+		"reason": err.Error(),
+	})
+}
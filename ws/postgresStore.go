@@ -0,0 +1,116 @@
+package ws
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+)
+
+type PostgresStore struct {
+	db *sql.DB
+}
+
+func NewPostgresStore(db *sql.DB) (*PostgresStore, error) {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS room_snapshots (
+		room_id    TEXT PRIMARY KEY,
+		state      JSONB NOT NULL,
+		updated_at TIMESTAMPTZ NOT NULL
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create room_snapshots table: %w", err)
+	}
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS room_events (
+		room_id TEXT NOT NULL,
+		seq     INTEGER NOT NULL,
+		event   JSONB NOT NULL,
+		PRIMARY KEY (room_id, seq)
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create room_events table: %w", err)
+	}
+	return &PostgresStore{db: db}, nil
+}
+
+func (s *PostgresStore) SaveRoom(snapshot *RoomSnapshot) error {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("failed to encode room %s: %w", snapshot.ID, err)
+	}
+	_, err = s.db.Exec(`INSERT INTO room_snapshots (room_id, state, updated_at) VALUES ($1, $2, $3)
+		ON CONFLICT (room_id) DO UPDATE SET state = EXCLUDED.state, updated_at = EXCLUDED.updated_at`,
+		snapshot.ID, data, snapshot.SavedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save room %s: %w", snapshot.ID, err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) LoadRooms() ([]*RoomSnapshot, error) {
+	rows, err := s.db.Query(`SELECT state FROM room_snapshots`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load rooms: %w", err)
+	}
+	defer rows.Close()
+	var snapshots []*RoomSnapshot
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("failed to load rooms: %w", err)
+		}
+		var snapshot RoomSnapshot
+		if err := json.Unmarshal(data, &snapshot); err != nil {
+			return nil, fmt.Errorf("failed to decode room: %w", err)
+		}
+		snapshots = append(snapshots, &snapshot)
+	}
+	return snapshots, rows.Err()
+}
+
+func (s *PostgresStore) DeleteRoom(id string) error {
+	_, err := s.db.Exec(`DELETE FROM room_snapshots WHERE room_id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete room %s: %w", id, err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) AppendEvents(roomID string, events []GameEvent) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to save events for room %s: %w", roomID, err)
+	}
+	defer tx.Rollback()
+	for _, event := range events {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("failed to encode event %d: %w", event.Seq, err)
+		}
+		_, err = tx.Exec(`INSERT INTO room_events (room_id, seq, event) VALUES ($1, $2, $3)
+			ON CONFLICT (room_id, seq) DO NOTHING`, roomID, event.Seq, data)
+		if err != nil {
+			return fmt.Errorf("failed to save event %d for room %s: %w", event.Seq, roomID, err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *PostgresStore) LoadEvents(roomID string) ([]GameEvent, error) {
+	rows, err := s.db.Query(`SELECT event FROM room_events WHERE room_id = $1 ORDER BY seq`, roomID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load events for room %s: %w", roomID, err)
+	}
+	defer rows.Close()
+	var events []GameEvent
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("failed to load events for room %s: %w", roomID, err)
+		}
+		var event GameEvent
+		if err := json.Unmarshal(data, &event); err != nil {
+			return nil, fmt.Errorf("failed to decode event: %w", err)
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
@@ -0,0 +1,84 @@
+package ws
+
+import "slices"
+
+// priorityEvents is what a pass of priority led to: the top of the stack
+// resolving, or everyone passing on an empty stack and the turn moving on.
+type priorityEvents struct {
+	Resolved *StackItem
+	Card     *BoardCard
+	Advanced bool
+	Turn     turnEvents
+}
+
+// resetPriority gives priority to the player with nobody having passed yet.
+// The caller must hold r.mu.
+func (r *Room) resetPriority(player string) {
+	r.Priority = player
+	r.PriorityPasses = make(map[string]bool)
+}
+
+// autoYields reports whether the player has asked to pass automatically in
+// the current step. The active player always gets to act, and nobody yields
+// while there is something on the stack or someone has asked to hold.
+func (r *Room) autoYields(player string) bool {
+	if player == r.Turn || len(r.Stack) > 0 || r.Hold != "" {
+		return false
+	}
+	return slices.Contains(r.TurnOptions[player].AutoYield, r.Step)
+}
+
+// passPriority records the holder's pass and hands priority on in turn
+// order, skipping players who auto-yield. Once every player still in the game
+// has passed in a row, the top of the stack resolves or, if it is empty, the
+// game moves to the next step. The caller must hold r.mu.
+func (r *Room) passPriority(username string) (priorityEvents, error) {
+	r.PriorityPasses[username] = true
+	if r.Hold == username {
+		r.Hold = ""
+	}
+	next := username
+	for !r.allPassed() {
+		next = getNextTurn(r.PlayerPositions, r.Eliminated, next)
+		if r.PriorityPasses[next] {
+			continue
+		}
+		r.Priority = next
+		if !r.autoYields(next) {
+			return priorityEvents{}, nil
+		}
+		r.PriorityPasses[next] = true
+	}
+
+	if len(r.Stack) > 0 {
+		item, boardCard, err := r.resolveTop()
+		return priorityEvents{Resolved: item, Card: boardCard}, err
+	}
+	return priorityEvents{Advanced: true, Turn: r.advanceStep()}, nil
+}
+
+func (r *Room) allPassed() bool {
+	for _, player := range r.remainingPlayers() {
+		if !r.PriorityPasses[player] {
+			return false
+		}
+	}
+	return true
+}
+
+// hold stops the game moving on so the player can respond: they get priority
+// and nobody auto-yields until they pass. The caller must hold r.mu.
+func (r *Room) hold(username string) {
+	r.Hold = username
+	r.resetPriority(username)
+}
+
+func (r *Room) priorityState() map[string]interface{} {
+	return map[string]interface{}{
+		"type":           "PRIORITY_STATE",
+		"priority":       r.Priority,
+		"priorityPasses": r.PriorityPasses,
+		"hold":           r.Hold,
+		"step":           r.Step,
+	}
+}
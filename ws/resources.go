@@ -0,0 +1,89 @@
+package ws
+
+import "errors"
+
+const defaultStartingLife = 40
+
+// Player resources tracked out of the box. Any other non-empty kind is
+// accepted as a custom resource.
+const (
+	ResourcePoison     = "poison"
+	ResourceEnergy     = "energy"
+	ResourceExperience = "experience"
+)
+
+// Designations are held by at most one player at a time.
+const (
+	DesignationMonarch    = "monarch"
+	DesignationInitiative = "initiative"
+)
+
+func isDesignation(kind string) bool {
+	return kind == DesignationMonarch || kind == DesignationInitiative
+}
+
+// setResource sets how much of a resource a player has. Resources never go
+// below zero.
+func (r *Room) setResource(player string, kind string, count int) error {
+	if kind == "" || len(kind) > maxCounterKindLength {
+		return errors.New("invalid resource kind")
+	}
+	resources, ok := r.Resources[player]
+	if !ok {
+		resources = make(map[string]int)
+		r.Resources[player] = resources
+	}
+	if count <= 0 {
+		delete(resources, kind)
+		return nil
+	}
+	resources[kind] = count
+	return nil
+}
+
+// setCommanderDamage records how much combat damage a player has been dealt
+// by one commander, keyed by the commander's card ID.
+func (r *Room) setCommanderDamage(player string, commanderID string, damage int) error {
+	if !r.isCommander(commanderID) {
+		return errors.New("card is not a commander")
+	}
+	damages, ok := r.CommanderDamage[player]
+	if !ok {
+		damages = make(map[string]int)
+		r.CommanderDamage[player] = damages
+	}
+	if damage <= 0 {
+		delete(damages, commanderID)
+		return nil
+	}
+	damages[commanderID] = damage
+	return nil
+}
+
+func (r *Room) isCommander(cardID string) bool {
+	for _, deck := range r.Decks {
+		for _, commander := range deck.Commanders {
+			if commander.ID == cardID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// setDesignation gives a designation such as the monarch to a player, taking
+// it from whoever held it. An empty player clears it.
+func (r *Room) setDesignation(kind string, player string) error {
+	if !isDesignation(kind) {
+		return errors.New("unknown designation: " + kind)
+	}
+	if player == "" {
+		delete(r.Designations, kind)
+		return nil
+	}
+	if _, ok := r.PlayerPositions[player]; !ok {
+		return errors.New("designation holder is not a player in this room")
+	}
+	r.Designations[kind] = player
+	return nil
+}
@@ -1,13 +1,21 @@
 package ws
 
 import (
+	crand "crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"log"
 	"sync"
+	"time"
 )
 
 var defaultPositions = []string{"bottomLeft", "topLeft", "topRight", "bottomRight"}
 
+const (
+	defaultReconnectGrace = 2 * time.Minute
+	snapshotInterval      = 30 * time.Second
+)
+
 type Room struct {
 	ID              string
 	Clients         map[*Client]bool
@@ -20,15 +28,53 @@ type Room struct {
 	DeckURLs        map[string]string
 	Decks           map[string]*Deck
 	PlayerPositions map[string]string
-	HandSizes       map[string]int
+	Hands           map[string][]Card
 	LifeTotals      map[string]int
+	StartingLife    int
+	Resources       map[string]map[string]int
+	CommanderDamage map[string]map[string]int
+	Designations    map[string]string
+	Eliminated      map[string]string
 	Turn            string
+	TurnNumber      int
+	Step            string
+	TurnOptions     map[string]TurnOptions
+	Combat          map[string]*Attack
+	Stack           []*StackItem
+	Priority        string
+	PriorityPasses  map[string]bool
+	Hold            string
 	Counters        map[string]*Counter
+	Arrows          map[string]*Arrow
 	DiceRollers     map[string]*DiceRoller
+	Zones           map[string]PlayerZones
+	CommanderCasts  map[string]int
+	ResumeTokens    map[string]string
+	Disconnected    map[string]time.Time
+	ReconnectGrace  time.Duration
+	Store           RoomStore
+	Events          []GameEvent
+	persistedEvents int
+	actionMu        sync.Mutex
+	recorded        map[string]json.RawMessage
+	sendMu          sync.Mutex
+	holding         bool
+	held            []delivery
+	UndoDepth       int
+	undoHistory     map[string][]undoEntry
+	Seeds           []*SeedEpoch
+	SeedSecret      string
+	Nonce           uint64
+	DiceRolls       []DiceRoll
+	Shuffles        []ShuffleRecord
+	scries          map[string]*pendingScry
+	expire          chan string
+	save            chan struct{}
+	done            chan struct{}
 }
 
 func NewRoom(id string) *Room {
-	return &Room{
+	room := &Room{
 		ID:              id,
 		Clients:         make(map[*Client]bool),
 		Spectators:      make(map[*Client]bool),
@@ -39,209 +85,139 @@ func NewRoom(id string) *Room {
 		DeckURLs:        make(map[string]string),
 		Decks:           make(map[string]*Deck),
 		PlayerPositions: make(map[string]string),
-		HandSizes:       make(map[string]int),
+		Hands:           make(map[string][]Card),
 		LifeTotals:      make(map[string]int),
+		StartingLife:    defaultStartingLife,
+		Resources:       make(map[string]map[string]int),
+		CommanderDamage: make(map[string]map[string]int),
+		Designations:    make(map[string]string),
+		Eliminated:      make(map[string]string),
 		Turn:            "",
+		TurnOptions:     make(map[string]TurnOptions),
+		Combat:          make(map[string]*Attack),
+		Stack:           []*StackItem{},
+		PriorityPasses:  make(map[string]bool),
 		Counters:        make(map[string]*Counter),
+		Arrows:          make(map[string]*Arrow),
 		DiceRollers:     make(map[string]*DiceRoller),
+		Zones:           make(map[string]PlayerZones),
+		CommanderCasts:  make(map[string]int),
+		ResumeTokens:    make(map[string]string),
+		Disconnected:    make(map[string]time.Time),
+		ReconnectGrace:  defaultReconnectGrace,
+		UndoDepth:       defaultUndoDepth,
+		undoHistory:     make(map[string][]undoEntry),
+		scries:          make(map[string]*pendingScry),
+		expire:          make(chan string),
+		save:            make(chan struct{}, 1),
+		done:            make(chan struct{}),
+	}
+	if err := room.startSeedEpoch(); err != nil {
+		log.Printf("error seeding room %s: %v", id, err)
 	}
+	return room
 }
 
-func (r *Room) BroadcastSafe(msg []byte) {
-	r.mu.Lock()
-	defer r.mu.Unlock()
+// delivery is a message on its way to one client. A nil message tells the
+// client's write loop to hang up.
+type delivery struct {
+	client *Client
+	data   []byte
+}
 
-	for client := range r.Clients {
-		select {
-		case client.Send <- msg:
-			// message sent successfully
-		default:
-			log.Printf("dropping unresponsive client: %s", client.Username)
-			client.close()
-		}
+// deliver sends messages to their clients, dropping any client that is not
+// keeping up. While an action is running its messages are held instead, so
+// that nothing is sent under actionMu; see recordAction.
+func (r *Room) deliver(deliveries ...delivery) {
+	r.sendMu.Lock()
+	defer r.sendMu.Unlock()
+	if r.holding {
+		r.held = append(r.held, deliveries...)
+		return
 	}
+	sendAll(deliveries)
+}
 
-	for spectator := range r.Spectators {
+func sendAll(deliveries []delivery) {
+	for _, d := range deliveries {
 		select {
-		case spectator.Send <- msg:
+		case d.client.Send <- d.data:
+			// message sent successfully
 		default:
-			log.Printf("dropping unresponsive spectator: %s", spectator.Username)
-			spectator.close()
+			log.Printf("dropping unresponsive client: %s", d.client.Username)
+			d.client.close()
 		}
 	}
 }
 
+func (r *Room) BroadcastSafe(msg []byte) {
+	r.BroadcastExcept(msg, nil)
+}
+
 func (r *Room) BroadcastExcept(msg []byte, exclude *Client) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
+	var deliveries []delivery
 	for client := range r.Clients {
 		if client != exclude {
-			select {
-			case client.Send <- msg:
-				// message sent successfully
-			default:
-				log.Printf("dropping unresponsive client: %s", client.Username)
-				client.close()
-			}
+			deliveries = append(deliveries, delivery{client: client, data: msg})
 		}
 	}
-
 	for spectator := range r.Spectators {
 		if spectator != exclude {
-			select {
-			case spectator.Send <- msg:
-			default:
-				log.Printf("dropping unresponsive spectator: %s", spectator.Username)
-				spectator.close()
-			}
+			deliveries = append(deliveries, delivery{client: spectator, data: msg})
+		}
+	}
+	r.deliver(deliveries...)
+}
+
+// BroadcastEach sends every client and spectator its own payload, built by
+// view from the username of the recipient. Spectators are given an empty
+// username so they only ever see public information.
+func (r *Room) BroadcastEach(view func(username string) interface{}) {
+	r.BroadcastEachExcept(view, nil)
+}
+
+func (r *Room) BroadcastEachExcept(view func(username string) interface{}, exclude *Client) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var deliveries []delivery
+	for client := range r.Clients {
+		if client == exclude {
+			continue
+		}
+		data, err := json.Marshal(view(client.Username))
+		if err != nil {
+			continue
+		}
+		deliveries = append(deliveries, delivery{client: client, data: data})
+	}
+	for spectator := range r.Spectators {
+		if spectator == exclude {
+			continue
+		}
+		data, err := json.Marshal(view(""))
+		if err != nil {
+			continue
 		}
+		deliveries = append(deliveries, delivery{client: spectator, data: data})
 	}
+	r.deliver(deliveries...)
 }
 
 func (r *Room) Run() {
+	defer close(r.done)
+	saveTicker := time.NewTicker(snapshotInterval)
+	defer saveTicker.Stop()
 	for {
 		select {
 		case client := <-r.Register:
-			r.mu.Lock()
-
-			isSpectator := len(r.Clients) >= 4 || client.Spectator
-
-			var commanderBoardCards []*BoardCard
-			if isSpectator {
-				r.Spectators[client] = true
-			} else {
-				if _, exists := r.PlayerPositions[client.Username]; exists {
-					client.sendError("Username already in room")
-					r.mu.Unlock()
-					continue
-				}
-				r.Clients[client] = true
-
-				rawDeckJSON, err := FetchDeckJSON(client.DeckUrl)
-				if err != nil {
-					log.Printf("error fetching deck: %v", err)
-					client.sendError("Error fetching deck")
-					r.mu.Unlock()
-					continue
-				}
-				parsedCards, parsedCommanders, err := ParseDeck(rawDeckJSON)
-				if err != nil {
-					log.Printf("error parsing deck: %v", err)
-					r.mu.Unlock()
-					continue
-				}
-				r.DeckURLs[client.Username] = client.DeckUrl
-
-				if r.PlayerPositions == nil {
-					r.PlayerPositions = make(map[string]string)
-				}
-				taken := make(map[string]bool)
-				for _, pos := range r.PlayerPositions {
-					taken[pos] = true
-				}
-
-				var assigned string
-				for _, pos := range defaultPositions {
-					if !taken[pos] {
-						assigned = pos
-						break
-					}
-				}
-				if assigned == "" {
-					assigned = "unassigned"
-				}
-				r.PlayerPositions[client.Username] = assigned
-				pos := client.Room.PlayerPositions[client.Username]
-				var x, y float64
-				deckWidth := 60.0
-				deckHeight := 90.0
-				xOffset := 50.0
-				yOffset := 225.0
-				switch pos {
-				case "topLeft":
-					x = -xOffset - deckWidth/2
-					y = -yOffset - deckHeight/2
-				case "topRight":
-					x = xOffset - deckWidth/2
-					y = -yOffset - deckHeight/2
-				case "bottomLeft":
-					x = -xOffset - deckWidth/2
-					y = yOffset - deckHeight/2
-				case "bottomRight":
-					x = xOffset - deckWidth/2
-					y = yOffset - deckHeight/2
-				default:
-					x, y = 0, 0
-				}
-				deck := &Deck{
-					ID:         client.Username,
-					X:          x,
-					Y:          y,
-					Cards:      parsedCards,
-					Commanders: parsedCommanders,
-				}
-				r.Decks[client.Username] = deck
-				commanderYOffset := 100.0
-				if pos == "bottomLeft" || pos == "bottomRight" {
-					commanderYOffset = -100.0
-				}
-				commanderXOffsetSign := -1.0
-				switch pos {
-				case "topRight", "bottomRight":
-					commanderXOffsetSign = 1.0
-				}
-				for i, commander := range parsedCommanders {
-					card := &BoardCard{
-						Card:      commander,
-						X:         x + commanderXOffsetSign*float64(i)*70,
-						Y:         y + commanderYOffset,
-						Owner:     client.Username,
-						Tapped:    false,
-						FlipIndex: 0,
-					}
-					r.Cards[commander.ID] = card
-					commanderBoardCards = append(commanderBoardCards, card)
-				}
-				r.LifeTotals[client.Username] = 40
-				r.Decks[client.Username] = deck
-
-				r.HandSizes[client.Username] = 0
-			}
-
-			cards := make([]*BoardCard, 0, len(r.Cards))
-			for _, card := range r.Cards {
-				cards = append(cards, card)
-			}
-
-			payload := map[string]interface{}{
-				"type":        "BOARD_STATE",
-				"cards":       cards,
-				"decks":       r.Decks,
-				"users":       r.GetUsernames(),
-				"positions":   r.PlayerPositions,
-				"handSizes":   r.HandSizes,
-				"turn":        r.Turn,
-				"counters":    r.Counters,
-				"diceRollers": r.DiceRollers,
-				"spectators":  r.GetSpectators(),
-				"lifeTotals":  r.LifeTotals,
-			}
-			data, _ := json.Marshal(payload)
-			client.Send <- data
-			r.mu.Unlock()
-
-			payload2 := map[string]interface{}{
-				"type":       "USER_JOINED",
-				"users":      r.GetUsernames(),
-				"spectators": r.GetSpectators(),
-				"decks":      r.Decks,
-				"positions":  r.PlayerPositions,
-				"commanders": commanderBoardCards,
-				"lifeTotals": r.LifeTotals,
-			}
-			joinedData, _ := json.Marshal(payload2)
-			client.Room.BroadcastExcept(joinedData, client)
+			r.recordAction(client.Username, "USER_JOINED", nil, nil, func() {
+				r.register(client)
+			})
+			r.persist()
 
 		case msg := <-r.Broadcast:
 			log.Printf("Broadcasting to %d clients", len(r.Clients))
@@ -249,47 +225,407 @@ func (r *Room) Run() {
 			r.BroadcastSafe(msg)
 
 		case client := <-r.Unregister:
-			r.mu.Lock()
-			log.Printf("Client %s disconnected", client.Username)
-			if _, ok := r.Spectators[client]; ok {
-				delete(r.Spectators, client)
-				r.mu.Unlock()
-			} else if _, ok := r.Clients[client]; ok {
-				delete(r.Clients, client)
-				delete(r.Decks, client.Username)
-				delete(r.DeckURLs, client.Username)
-				delete(r.PlayerPositions, client.Username)
-				delete(r.HandSizes, client.Username)
-				for id, card := range r.Cards {
-					if card.Owner == client.Username {
-						delete(r.Cards, id)
-					}
-				}
-				if r.Turn == client.Username {
-					r.Turn = getNextTurn(r.PlayerPositions, r.Turn)
-				}
-				payload := map[string]interface{}{
-					"type":      "USER_LEFT",
-					"user":      client.Username,
-					"positions": r.PlayerPositions,
-					"turn":      r.Turn,
-				}
-				data, _ := json.Marshal(payload)
-				r.mu.Unlock()
-				r.BroadcastSafe(data)
-			} else {
-				r.mu.Unlock()
+			r.recordAction(client.Username, "USER_DISCONNECTED", nil, nil, func() {
+				r.unregister(client)
+			})
+			if r.isEmpty() {
+				r.finish()
+				return
 			}
+			r.persist()
 
-			r.mu.Lock()
-			if len(r.Clients) == 0 {
-				r.mu.Unlock()
+		case username := <-r.expire:
+			r.recordAction(username, "USER_LEFT", nil, nil, func() {
+				r.expireSeat(username)
+			})
+			if r.isEmpty() {
+				r.finish()
 				return
 			}
+			r.persist()
+
+		case <-r.save:
+			r.persist()
+
+		case <-saveTicker.C:
+			r.persist()
+		}
+	}
+}
+
+func (r *Room) register(client *Client) {
+	r.mu.Lock()
+
+	if _, seated := r.PlayerPositions[client.Username]; seated && !client.Spectator {
+		if !r.canResume(client) {
+			client.reject("Username already in room")
 			r.mu.Unlock()
+			return
+		}
+		r.Clients[client] = true
+		delete(r.Disconnected, client.Username)
+		data, _ := json.Marshal(r.boardState(client.Username))
+		r.deliver(delivery{client: client, data: data})
+		payload := map[string]interface{}{
+			"type":       "USER_RECONNECTED",
+			"user":       client.Username,
+			"users":      r.GetUsernames(),
+			"spectators": r.GetSpectators(),
+		}
+		reconnectedData, _ := json.Marshal(payload)
+		r.mu.Unlock()
+		r.BroadcastExcept(reconnectedData, client)
+		return
+	}
+
+	isSpectator := len(r.PlayerPositions) >= 4 || client.Spectator
+
+	if isSpectator {
+		r.Spectators[client] = true
+	} else {
+		if _, exists := r.PlayerPositions[client.Username]; exists {
+			client.reject("Username already in room")
+			r.mu.Unlock()
+			return
+		}
+		var parsedCards, parsedCommanders []Card
+		var err error
+		if client.DeckList != "" {
+			parsedCards, parsedCommanders, err = LoadDeckList(client.DeckList)
+		} else {
+			parsedCards, parsedCommanders, err = LoadDeck(client.DeckUrl)
+		}
+		if err != nil {
+			log.Printf("error loading deck: %v", err)
+			client.reject("Error fetching deck")
+			r.mu.Unlock()
+			return
+		}
+		r.Clients[client] = true
+		r.DeckURLs[client.Username] = client.DeckUrl
 
+		if r.PlayerPositions == nil {
+			r.PlayerPositions = make(map[string]string)
+		}
+		taken := make(map[string]bool)
+		for _, pos := range r.PlayerPositions {
+			taken[pos] = true
+		}
+
+		var assigned string
+		for _, pos := range defaultPositions {
+			if !taken[pos] {
+				assigned = pos
+				break
+			}
+		}
+		if assigned == "" {
+			assigned = "unassigned"
+		}
+		r.PlayerPositions[client.Username] = assigned
+		pos := client.Room.PlayerPositions[client.Username]
+		var x, y float64
+		deckWidth := 60.0
+		deckHeight := 90.0
+		xOffset := 50.0
+		yOffset := 225.0
+		switch pos {
+		case "topLeft":
+			x = -xOffset - deckWidth/2
+			y = -yOffset - deckHeight/2
+		case "topRight":
+			x = xOffset - deckWidth/2
+			y = -yOffset - deckHeight/2
+		case "bottomLeft":
+			x = -xOffset - deckWidth/2
+			y = yOffset - deckHeight/2
+		case "bottomRight":
+			x = xOffset - deckWidth/2
+			y = yOffset - deckHeight/2
+		default:
+			x, y = 0, 0
+		}
+		deck := &Deck{
+			ID:         client.Username,
+			X:          x,
+			Y:          y,
+			Cards:      parsedCards,
+			Commanders: parsedCommanders,
 		}
+		r.Decks[client.Username] = deck
+		zones := newPlayerZones()
+		zones[ZoneCommand] = append(zones[ZoneCommand], parsedCommanders...)
+		r.Zones[client.Username] = zones
+		r.LifeTotals[client.Username] = r.StartingLife
+		r.Resources[client.Username] = make(map[string]int)
+		r.CommanderDamage[client.Username] = make(map[string]int)
+		r.Decks[client.Username] = deck
+
+		r.Hands[client.Username] = []Card{}
+		r.ResumeTokens[client.Username] = newResumeToken()
+		if _, err := r.shuffleLibrary(client.Username); err != nil {
+			log.Printf("error shuffling deck: %v", err)
+		}
+	}
+
+	viewer := client.Username
+	if isSpectator {
+		viewer = ""
+	}
+	data, _ := json.Marshal(r.boardState(viewer))
+	r.deliver(delivery{client: client, data: data})
+	r.mu.Unlock()
+
+	client.Room.BroadcastEachExcept(func(username string) interface{} {
+		return map[string]interface{}{
+			"type":       "USER_JOINED",
+			"users":      r.GetUsernames(),
+			"spectators": r.GetSpectators(),
+			"decks":      r.librariesFor(username),
+			"positions":  r.PlayerPositions,
+			"zones":      r.zonesFor(""),
+			"lifeTotals": r.LifeTotals,
+			"resources":  r.Resources,
+		}
+	}, client)
+}
+
+func (r *Room) unregister(client *Client) {
+	r.mu.Lock()
+	log.Printf("Client %s disconnected", client.Username)
+	if _, ok := r.Spectators[client]; ok {
+		delete(r.Spectators, client)
+		r.mu.Unlock()
+	} else if _, ok := r.Clients[client]; ok {
+		delete(r.Clients, client)
+		r.Disconnected[client.Username] = time.Now()
+		r.scheduleExpiry(client.Username)
+		payload := map[string]interface{}{
+			"type":           "USER_DISCONNECTED",
+			"user":           client.Username,
+			"users":          r.GetUsernames(),
+			"reconnectGrace": r.ReconnectGrace.Seconds(),
+		}
+		data, _ := json.Marshal(payload)
+		r.mu.Unlock()
+		r.BroadcastSafe(data)
+	} else {
+		r.mu.Unlock()
+	}
+}
+
+func (r *Room) expireSeat(username string) {
+	r.mu.Lock()
+	disconnectedAt, ok := r.Disconnected[username]
+	if !ok || time.Since(disconnectedAt) < r.ReconnectGrace {
+		r.mu.Unlock()
+		return
+	}
+	log.Printf("Seat for %s expired", username)
+	r.removePlayer(username)
+	payload := map[string]interface{}{
+		"type":      "USER_LEFT",
+		"user":      username,
+		"positions": r.PlayerPositions,
+		"turn":      r.Turn,
+	}
+	data, _ := json.Marshal(payload)
+	r.mu.Unlock()
+	r.BroadcastSafe(data)
+}
+
+// finish reveals the room's seed, so that every roll and shuffle of the
+// game can be verified from its log, and writes out the final state.
+func (r *Room) finish() {
+	r.recordAction("", "SEED_REVEALED", nil, nil, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if _, err := r.revealSeed(); err != nil {
+			log.Printf("error revealing seed for room %s: %v", r.ID, err)
+		}
+	})
+	r.persist()
+}
+
+// requestSave asks Run to write a snapshot. Requests made while one is
+// already pending are folded into it.
+func (r *Room) requestSave() {
+	select {
+	case r.save <- struct{}{}:
+	default:
+	}
+}
+
+func (r *Room) persist() {
+	if r.Store == nil {
+		return
+	}
+	r.mu.Lock()
+	if len(r.Events) == r.persistedEvents {
+		// every change is logged, so nothing has changed since the last save
+		r.mu.Unlock()
+		return
+	}
+	snapshot, err := r.snapshot()
+	events := r.Events[r.persistedEvents:]
+	r.mu.Unlock()
+	if err != nil {
+		log.Printf("error snapshotting room %s: %v", r.ID, err)
+		return
+	}
+	if err := r.Store.SaveRoom(snapshot); err != nil {
+		log.Printf("error saving room %s: %v", r.ID, err)
+		return
+	}
+	if len(events) == 0 {
+		return
+	}
+	if err := r.Store.AppendEvents(r.ID, events); err != nil {
+		log.Printf("error saving events for room %s: %v", r.ID, err)
+		return
+	}
+	r.persistedEvents += len(events)
+}
+
+func (r *Room) boardState(viewer string) map[string]interface{} {
+	payload := map[string]interface{}{
+		"type":            "BOARD_STATE",
+		"cards":           r.boardCardsFor(viewer),
+		"decks":           r.librariesFor(viewer),
+		"users":           r.GetUsernames(),
+		"positions":       r.PlayerPositions,
+		"handSizes":       r.handSizes(),
+		"hand":            r.Hands[viewer],
+		"hands":           r.handsFor(viewer),
+		"turn":            r.Turn,
+		"turnNumber":      r.TurnNumber,
+		"phase":           phaseOf(r.Step),
+		"step":            r.Step,
+		"turnOptions":     r.TurnOptions,
+		"stack":           r.Stack,
+		"priority":        r.Priority,
+		"priorityPasses":  r.PriorityPasses,
+		"hold":            r.Hold,
+		"counters":        r.Counters,
+		"arrows":          r.Arrows,
+		"diceRollers":     r.DiceRollers,
+		"spectators":      r.GetSpectators(),
+		"lifeTotals":      r.LifeTotals,
+		"resources":       r.Resources,
+		"commanderDamage": r.CommanderDamage,
+		"designations":    r.Designations,
+		"eliminated":      r.Eliminated,
+		"zones":           r.zonesFor(viewer),
+		"commanderTax":    r.commanderTax(),
+		"disconnected":    r.getDisconnected(),
+		"seeds":           r.Seeds,
+	}
+	if token, ok := r.ResumeTokens[viewer]; ok {
+		payload["resumeToken"] = token
 	}
+	if pending, ok := r.scries[viewer]; ok {
+		payload["scry"] = map[string]interface{}{
+			"cards":   r.Decks[viewer].peekTop(len(pending.Cards)),
+			"surveil": pending.Surveil,
+		}
+	}
+	return payload
+}
+
+func (r *Room) canResume(client *Client) bool {
+	if _, disconnected := r.Disconnected[client.Username]; !disconnected {
+		return false
+	}
+	token, ok := r.ResumeTokens[client.Username]
+	return ok && client.ResumeToken != "" && client.ResumeToken == token
+}
+
+// scheduleExpiry releases a disconnected player's seat once the reconnect
+// grace period is over, unless they came back in the meantime.
+func (r *Room) scheduleExpiry(username string) {
+	time.AfterFunc(r.ReconnectGrace, func() {
+		select {
+		case r.expire <- username:
+		case <-r.done:
+		}
+	})
+}
+
+func (r *Room) removePlayer(username string) {
+	if r.Turn == username {
+		r.Turn = getNextTurn(r.PlayerPositions, r.Eliminated, r.Turn)
+	}
+	delete(r.Disconnected, username)
+	delete(r.ResumeTokens, username)
+	delete(r.Decks, username)
+	delete(r.DeckURLs, username)
+	delete(r.PlayerPositions, username)
+	delete(r.Hands, username)
+	delete(r.Zones, username)
+	delete(r.LifeTotals, username)
+	delete(r.Resources, username)
+	delete(r.CommanderDamage, username)
+	delete(r.Eliminated, username)
+	delete(r.TurnOptions, username)
+	delete(r.PriorityPasses, username)
+	if r.Priority == username || r.Hold == username {
+		r.Hold = ""
+		r.resetPriority(r.Turn)
+	}
+	stack := r.Stack[:0]
+	for _, item := range r.Stack {
+		if item.Controller != username {
+			stack = append(stack, item)
+		}
+	}
+	r.Stack = stack
+	for id, arrow := range r.Arrows {
+		if arrow.Owner == username || arrow.Source.Player == username || arrow.Target.Player == username {
+			delete(r.Arrows, id)
+		}
+	}
+	for id, attack := range r.Combat {
+		if r.defender(attack) == username {
+			delete(r.Combat, id)
+		}
+	}
+	for kind, holder := range r.Designations {
+		if holder == username {
+			delete(r.Designations, kind)
+		}
+	}
+	delete(r.undoHistory, username)
+	delete(r.scries, username)
+	for id, card := range r.Cards {
+		if card.Owner == username {
+			r.removeFromBoard(id)
+		} else if card.Controller == username {
+			card.Controller = card.Owner
+		}
+	}
+	if r.Turn == username {
+		r.Turn = ""
+	}
+}
+
+func (r *Room) isEmpty() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.Clients) == 0 && len(r.Disconnected) == 0
+}
+
+func (r *Room) getDisconnected() []string {
+	usernames := []string{}
+	for username := range r.Disconnected {
+		usernames = append(usernames, username)
+	}
+	return usernames
+}
+
+func newResumeToken() string {
+	token := make([]byte, 16)
+	crand.Read(token)
+	return hex.EncodeToString(token)
 }
 
 func (r *Room) GetUsernames() []string {
@@ -308,7 +644,7 @@ func (r *Room) GetSpectators() []string {
 	return usernames
 }
 
-func getNextTurn(positions map[string]string, activePlayer string) string {
+func getNextTurn(positions map[string]string, eliminated map[string]string, activePlayer string) string {
 
 	posToPlayer := make(map[string]string)
 	for user, pos := range positions {
@@ -326,7 +662,7 @@ func getNextTurn(positions map[string]string, activePlayer string) string {
 		nextIdx := (currentIdx + i) % 4
 		nextPos := defaultPositions[nextIdx]
 		nextPlayer, exists := posToPlayer[nextPos]
-		if exists {
+		if _, out := eliminated[nextPlayer]; exists && !out {
 			return nextPlayer
 		}
 	}
@@ -0,0 +1,77 @@
+package ws
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// RoomStore persists room snapshots so games survive a server restart, and
+// room event logs so games can be reviewed after they end. Deleting a room
+// keeps its events.
+type RoomStore interface {
+	SaveRoom(snapshot *RoomSnapshot) error
+	LoadRooms() ([]*RoomSnapshot, error)
+	DeleteRoom(id string) error
+	AppendEvents(roomID string, events []GameEvent) error
+	LoadEvents(roomID string) ([]GameEvent, error)
+}
+
+// MemoryStore keeps snapshots in process memory. It is meant for tests and
+// local development where no database is available.
+type MemoryStore struct {
+	mu     sync.Mutex
+	rooms  map[string][]byte
+	events map[string][]GameEvent
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		rooms:  make(map[string][]byte),
+		events: make(map[string][]GameEvent),
+	}
+}
+
+func (s *MemoryStore) SaveRoom(snapshot *RoomSnapshot) error {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rooms[snapshot.ID] = data
+	return nil
+}
+
+func (s *MemoryStore) LoadRooms() ([]*RoomSnapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snapshots := make([]*RoomSnapshot, 0, len(s.rooms))
+	for _, data := range s.rooms {
+		var snapshot RoomSnapshot
+		if err := json.Unmarshal(data, &snapshot); err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, &snapshot)
+	}
+	return snapshots, nil
+}
+
+func (s *MemoryStore) DeleteRoom(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.rooms, id)
+	return nil
+}
+
+func (s *MemoryStore) AppendEvents(roomID string, events []GameEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events[roomID] = append(s.events[roomID], events...)
+	return nil
+}
+
+func (s *MemoryStore) LoadEvents(roomID string) ([]GameEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]GameEvent{}, s.events[roomID]...), nil
+}
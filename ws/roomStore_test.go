@@ -0,0 +1,64 @@
+package ws
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoadRoomsRestoresSavedRoom(t *testing.T) {
+	store := NewMemoryStore()
+	hub := NewHub()
+	hub.Store = store
+
+	room := hub.newRoom("table")
+	room.PlayerPositions["alice"] = "bottomLeft"
+	room.PlayerPositions["bob"] = "topLeft"
+	room.LifeTotals["alice"] = 31
+	room.LifeTotals["bob"] = 12
+	room.Turn = "bob"
+	room.TurnNumber = 4
+	room.Step = StepMain1
+	room.ResumeTokens["alice"] = "alice-token"
+	room.ResumeTokens["bob"] = "bob-token"
+	room.Cards["c1"] = &BoardCard{Card: Card{ID: "c1", Name: "Sol Ring"}, X: 10, Y: 20, Owner: "alice", Tapped: true}
+	room.Decks["alice"] = &Deck{ID: "alice", Cards: []Card{{ID: "d1", Name: "Island"}, {ID: "d2", Name: "Forest"}}}
+	room.Events = []GameEvent{{Seq: 1, Actor: "alice", Type: "TAP_CARD"}}
+	room.persist()
+
+	restarted := NewHub()
+	restarted.Store = store
+	restarted.ReconnectGrace = time.Hour
+	if err := restarted.LoadRooms(); err != nil {
+		t.Fatal(err)
+	}
+	restarted.Mu.Lock()
+	restored, ok := restarted.Rooms["table"]
+	restarted.Mu.Unlock()
+	if !ok {
+		t.Fatal("room was not restored")
+	}
+
+	restored.mu.Lock()
+	defer restored.mu.Unlock()
+	if card := restored.Cards["c1"]; card == nil || card.Name != "Sol Ring" || card.X != 10 || !card.Tapped || card.Owner != "alice" {
+		t.Errorf("card = %+v", card)
+	}
+	if deck := restored.Decks["alice"]; deck == nil || len(deck.Cards) != 2 || deck.Cards[1].Name != "Forest" {
+		t.Errorf("deck = %+v", deck)
+	}
+	if restored.LifeTotals["alice"] != 31 || restored.LifeTotals["bob"] != 12 {
+		t.Errorf("life totals = %v", restored.LifeTotals)
+	}
+	if restored.Turn != "bob" || restored.TurnNumber != 4 || restored.Step != StepMain1 {
+		t.Errorf("turn = %s %d %s", restored.Turn, restored.TurnNumber, restored.Step)
+	}
+	if restored.ResumeTokens["alice"] != "alice-token" || restored.ResumeTokens["bob"] != "bob-token" {
+		t.Errorf("resume tokens = %v", restored.ResumeTokens)
+	}
+	if _, ok := restored.Disconnected["alice"]; !ok {
+		t.Error("restored players should wait to reconnect")
+	}
+	if len(restored.Events) != 1 || restored.Events[0].Type != "TAP_CARD" {
+		t.Errorf("events = %+v", restored.Events)
+	}
+}
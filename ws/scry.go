@@ -0,0 +1,89 @@
+package ws
+
+import "errors"
+
+const maxScry = 100
+
+// pendingScry is a scry or surveil a player has begun: the cards they were
+// shown, by ID, in library order.
+type pendingScry struct {
+	Cards   []string
+	Surveil bool
+}
+
+// beginScry shows a player the top of their library and remembers what they
+// were shown, so the order they send back can be checked against it.
+func (r *Room) beginScry(username string, count int, surveil bool) ([]Card, error) {
+	deck, ok := r.Decks[username]
+	if !ok {
+		return nil, errors.New("player has no library")
+	}
+	if count < 1 || count > maxScry {
+		return nil, errors.New("invalid number of cards to scry")
+	}
+	cards := deck.peekTop(count)
+	for _, card := range cards {
+		if deck.Known[card.ID] != KnownPublic {
+			deck.know(card.ID, KnownOwner)
+		}
+	}
+	r.scries[username] = &pendingScry{Cards: cardIDs(cards), Surveil: surveil}
+	return cards, nil
+}
+
+// resolveScry puts the scried cards back as the player chose: top and bottom
+// in the order given, first card on top, and, when surveilling, the rest into
+// the graveyard. It returns the cards put into the graveyard.
+func (r *Room) resolveScry(username string, top, bottom, graveyard []string) ([]Card, error) {
+	pending, ok := r.scries[username]
+	if !ok {
+		return nil, errors.New("no scry in progress")
+	}
+	deck, ok := r.Decks[username]
+	if !ok {
+		return nil, errors.New("player has no library")
+	}
+	if len(graveyard) > 0 && !pending.Surveil {
+		return nil, errors.New("scried cards cannot be put into the graveyard")
+	}
+	if !sameOrder(cardIDs(deck.peekTop(len(pending.Cards))), pending.Cards) {
+		delete(r.scries, username)
+		return nil, errors.New("library changed during scry")
+	}
+	chosen := make(map[string]bool, len(pending.Cards))
+	for _, ids := range [][]string{top, bottom, graveyard} {
+		for _, id := range ids {
+			if chosen[id] || !contains(pending.Cards, id) {
+				return nil, errors.New("scry must place exactly the cards that were seen")
+			}
+			chosen[id] = true
+		}
+	}
+	if len(chosen) != len(pending.Cards) {
+		return nil, errors.New("scry must place exactly the cards that were seen")
+	}
+
+	seen := make(map[string]Card, len(pending.Cards))
+	for _, card := range deck.Cards[:len(pending.Cards)] {
+		seen[card.ID] = card
+	}
+	rest := deck.Cards[len(pending.Cards):]
+	cards := make([]Card, 0, len(deck.Cards)-len(graveyard))
+	for _, id := range top {
+		cards = append(cards, seen[id])
+	}
+	cards = append(cards, rest...)
+	for _, id := range bottom {
+		cards = append(cards, seen[id])
+	}
+	deck.Cards = cards
+
+	toGraveyard := make([]Card, 0, len(graveyard))
+	for _, id := range graveyard {
+		delete(deck.Known, id)
+		r.putCard(username, ZoneLibrary, ZoneGraveyard, seen[id], 0, 0)
+		toGraveyard = append(toGraveyard, seen[id])
+	}
+	delete(r.scries, username)
+	return toGraveyard, nil
+}
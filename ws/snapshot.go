@@ -0,0 +1,146 @@
+package ws
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// RoomSnapshot is everything needed to bring a room back after a restart.
+// Connections are not part of it: restored players rejoin with their resume
+// token within the reconnect grace period.
+type RoomSnapshot struct {
+	ID              string                    `json:"id"`
+	Cards           map[string]*BoardCard     `json:"cards"`
+	DeckURLs        map[string]string         `json:"deckUrls"`
+	Decks           map[string]*Deck          `json:"decks"`
+	PlayerPositions map[string]string         `json:"positions"`
+	Hands           map[string][]Card         `json:"hands"`
+	LifeTotals      map[string]int            `json:"lifeTotals"`
+	Resources       map[string]map[string]int `json:"resources"`
+	CommanderDamage map[string]map[string]int `json:"commanderDamage"`
+	Designations    map[string]string         `json:"designations"`
+	Eliminated      map[string]string         `json:"eliminated"`
+	Turn            string                    `json:"turn"`
+	TurnNumber      int                       `json:"turnNumber"`
+	Step            string                    `json:"step"`
+	TurnOptions     map[string]TurnOptions    `json:"turnOptions"`
+	Combat          map[string]*Attack        `json:"combat"`
+	Stack           []*StackItem              `json:"stack"`
+	Priority        string                    `json:"priority"`
+	PriorityPasses  map[string]bool           `json:"priorityPasses"`
+	Hold            string                    `json:"hold"`
+	Counters        map[string]*Counter       `json:"counters"`
+	Arrows          map[string]*Arrow         `json:"arrows"`
+	DiceRollers     map[string]*DiceRoller    `json:"diceRollers"`
+	Zones           map[string]PlayerZones    `json:"zones"`
+	CommanderCasts  map[string]int            `json:"commanderCasts"`
+	ResumeTokens    map[string]string         `json:"resumeTokens"`
+	Seeds           []*SeedEpoch              `json:"seeds"`
+	SeedSecret      string                    `json:"seedSecret"`
+	Nonce           uint64                    `json:"nonce"`
+	DiceRolls       []DiceRoll                `json:"diceRolls"`
+	Shuffles        []ShuffleRecord           `json:"shuffles"`
+	SavedAt         time.Time                 `json:"savedAt"`
+}
+
+// liveSnapshot refers to the room's own maps rather than copying them.
+// The caller must hold r.mu for as long as it is used.
+func (r *Room) liveSnapshot() *RoomSnapshot {
+	return &RoomSnapshot{
+		ID:              r.ID,
+		Cards:           r.Cards,
+		DeckURLs:        r.DeckURLs,
+		Decks:           r.Decks,
+		PlayerPositions: r.PlayerPositions,
+		Hands:           r.Hands,
+		LifeTotals:      r.LifeTotals,
+		Resources:       r.Resources,
+		CommanderDamage: r.CommanderDamage,
+		Designations:    r.Designations,
+		Eliminated:      r.Eliminated,
+		Turn:            r.Turn,
+		TurnNumber:      r.TurnNumber,
+		Step:            r.Step,
+		TurnOptions:     r.TurnOptions,
+		Combat:          r.Combat,
+		Stack:           r.Stack,
+		Priority:        r.Priority,
+		PriorityPasses:  r.PriorityPasses,
+		Hold:            r.Hold,
+		Counters:        r.Counters,
+		Arrows:          r.Arrows,
+		DiceRollers:     r.DiceRollers,
+		Zones:           r.Zones,
+		CommanderCasts:  r.CommanderCasts,
+		ResumeTokens:    r.ResumeTokens,
+		Seeds:           r.Seeds,
+		SeedSecret:      r.SeedSecret,
+		Nonce:           r.Nonce,
+		DiceRolls:       r.DiceRolls,
+		Shuffles:        r.Shuffles,
+		SavedAt:         time.Now(),
+	}
+}
+
+// snapshot copies the room state. The caller must hold r.mu.
+func (r *Room) snapshot() (*RoomSnapshot, error) {
+	// round trip through JSON so the snapshot shares nothing with the room
+	data, err := json.Marshal(r.liveSnapshot())
+	if err != nil {
+		return nil, err
+	}
+	var snapshot RoomSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+// restore replaces the room state with the snapshot. The caller must hold r.mu.
+func (r *Room) restore(snapshot *RoomSnapshot) {
+	r.Cards = orEmpty(snapshot.Cards)
+	r.DeckURLs = orEmpty(snapshot.DeckURLs)
+	r.Decks = orEmpty(snapshot.Decks)
+	r.PlayerPositions = orEmpty(snapshot.PlayerPositions)
+	r.Hands = orEmpty(snapshot.Hands)
+	r.LifeTotals = orEmpty(snapshot.LifeTotals)
+	r.Resources = orEmpty(snapshot.Resources)
+	r.CommanderDamage = orEmpty(snapshot.CommanderDamage)
+	r.Designations = orEmpty(snapshot.Designations)
+	r.Eliminated = orEmpty(snapshot.Eliminated)
+	r.Turn = snapshot.Turn
+	r.TurnNumber = snapshot.TurnNumber
+	r.Step = snapshot.Step
+	r.TurnOptions = orEmpty(snapshot.TurnOptions)
+	r.Combat = orEmpty(snapshot.Combat)
+	r.Stack = append([]*StackItem{}, snapshot.Stack...)
+	r.Priority = snapshot.Priority
+	r.PriorityPasses = orEmpty(snapshot.PriorityPasses)
+	r.Hold = snapshot.Hold
+	r.Counters = orEmpty(snapshot.Counters)
+	r.Arrows = orEmpty(snapshot.Arrows)
+	r.DiceRollers = orEmpty(snapshot.DiceRollers)
+	r.Zones = orEmpty(snapshot.Zones)
+	r.CommanderCasts = orEmpty(snapshot.CommanderCasts)
+	r.ResumeTokens = orEmpty(snapshot.ResumeTokens)
+	r.Seeds = snapshot.Seeds
+	r.SeedSecret = snapshot.SeedSecret
+	r.Nonce = snapshot.Nonce
+	r.DiceRolls = snapshot.DiceRolls
+	r.Shuffles = snapshot.Shuffles
+}
+
+// copyPrivate carries over the state that is kept out of the event log, and
+// so out of entries, when a snapshot is rebuilt from entries.
+func (s *RoomSnapshot) copyPrivate(from *RoomSnapshot) {
+	s.ResumeTokens = from.ResumeTokens
+	s.SeedSecret = from.SeedSecret
+	s.Nonce = from.Nonce
+}
+
+func orEmpty[K comparable, V any](m map[K]V) map[K]V {
+	if m == nil {
+		return make(map[K]V)
+	}
+	return m
+}
@@ -0,0 +1,136 @@
+package ws
+
+import "errors"
+
+const maxAbilityTextLength = 500
+
+// StackItem is a spell or an ability waiting to resolve. Spells carry their
+// card and where it goes when it resolves; abilities carry the card they come
+// from and a description.
+type StackItem struct {
+	ID          string  `json:"id"`
+	Controller  string  `json:"controller"`
+	Card        *Card   `json:"card,omitempty"`
+	From        string  `json:"from,omitempty"`
+	Destination string  `json:"destination,omitempty"`
+	X           float64 `json:"x,omitempty"`
+	Y           float64 `json:"y,omitempty"`
+	Source      string  `json:"source,omitempty"`
+	Text        string  `json:"text,omitempty"`
+}
+
+func (r *Room) onStack(id string) bool {
+	for _, item := range r.Stack {
+		if item.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// castToStack puts a spell from the player's hand or command zone on the
+// stack. When it resolves the card goes to destination, which defaults to the
+// battlefield at x, y. The caller must hold r.mu.
+func (r *Room) castToStack(username string, from string, cardID string, destination string, x, y float64) (*StackItem, error) {
+	if from != ZoneHand && from != ZoneCommand {
+		return nil, errors.New("spells are cast from hand or the command zone")
+	}
+	if destination == "" {
+		destination = ZoneBoard
+	}
+	if destination != ZoneBoard && !isNamedZone(destination) {
+		return nil, errors.New("spells resolve to the battlefield, graveyard, exile or command zone")
+	}
+	card, err := r.takeCard(username, from, cardID)
+	if err != nil {
+		return nil, err
+	}
+	if from == ZoneCommand {
+		r.CommanderCasts[card.ID] += 1
+	}
+	item := &StackItem{
+		ID:          card.ID,
+		Controller:  username,
+		Card:        &card,
+		From:        from,
+		Destination: destination,
+		X:           x,
+		Y:           y,
+	}
+	r.pushStack(item)
+	return item, nil
+}
+
+// addAbilityToStack puts an activated or triggered ability of a card the
+// player controls on the stack. The caller must hold r.mu.
+func (r *Room) addAbilityToStack(username string, id string, sourceID string, text string) (*StackItem, error) {
+	if id == "" || r.onStack(id) {
+		return nil, errors.New("ability needs a new id")
+	}
+	if len(text) > maxAbilityTextLength {
+		return nil, errors.New("ability text is too long")
+	}
+	if _, err := r.controlledCard(username, sourceID); err != nil {
+		return nil, err
+	}
+	item := &StackItem{
+		ID:         id,
+		Controller: username,
+		Source:     sourceID,
+		Text:       text,
+	}
+	r.pushStack(item)
+	return item, nil
+}
+
+func (r *Room) pushStack(item *StackItem) {
+	r.Stack = append(r.Stack, item)
+	r.resetPriority(item.Controller)
+}
+
+func (r *Room) popStack() (*StackItem, error) {
+	if len(r.Stack) == 0 {
+		return nil, errors.New("the stack is empty")
+	}
+	top := r.Stack[len(r.Stack)-1]
+	r.Stack = r.Stack[:len(r.Stack)-1]
+	r.resetPriority(r.Turn)
+	return top, nil
+}
+
+// resolveTop resolves the top of the stack. A spell's card goes to its
+// destination and, if that is the battlefield, the new permanent is returned.
+// The caller must hold r.mu.
+func (r *Room) resolveTop() (*StackItem, *BoardCard, error) {
+	top, err := r.popStack()
+	if err != nil || top.Card == nil {
+		return top, nil, err
+	}
+	boardCard, err := r.putCard(top.Controller, ZoneStack, top.Destination, *top.Card, top.X, top.Y)
+	return top, boardCard, err
+}
+
+// counterTop removes the top of the stack without resolving it. A countered
+// spell goes to its owner's graveyard. The caller must hold r.mu.
+func (r *Room) counterTop() (*StackItem, error) {
+	top, err := r.popStack()
+	if err != nil || top.Card == nil {
+		return top, err
+	}
+	_, err = r.putCard(top.Controller, ZoneStack, ZoneGraveyard, *top.Card, 0, 0)
+	return top, err
+}
+
+func (r *Room) stackState(action string, player string, item *StackItem) map[string]interface{} {
+	return map[string]interface{}{
+		"type":           "STACK_UPDATED",
+		"action":         action,
+		"player":         player,
+		"item":           item,
+		"stack":          r.Stack,
+		"priority":       r.Priority,
+		"priorityPasses": r.PriorityPasses,
+		"handSizes":      r.handSizes(),
+		"commanderTax":   r.commanderTax(),
+	}
+}
@@ -0,0 +1,142 @@
+package ws
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+)
+
+const maxTokenCopies = 100
+
+// scryfallAPIBase is where token names are looked up when no card catalog is
+// loaded.
+var scryfallAPIBase = "https://api.scryfall.com"
+
+var (
+	tokenNamesMu sync.Mutex
+	tokenNames   = make(map[string]string)
+)
+
+// newTokenRef describes a token by Scryfall ID, filling in its name and
+// image from the card catalog when one is loaded, or asking Scryfall for its
+// name when not.
+func newTokenRef(id string) TokenRef {
+	if cardCatalog != nil {
+		if token, ok := cardCatalog.ByID(id); ok {
+			return TokenRef{ID: id, Name: token.Name, ImageURL: token.ImageURL}
+		}
+	}
+	return TokenRef{
+		ID:       id,
+		Name:     tokenName(id),
+		ImageURL: fmt.Sprintf("https://api.scryfall.com/cards/%s?format=image&version=normal", id),
+	}
+}
+
+// tokenName fetches a token's name from Scryfall, remembering it so a deck
+// full of Treasure makers asks only once. Tokens Scryfall cannot name are
+// just called "Token".
+func tokenName(id string) string {
+	tokenNamesMu.Lock()
+	name, ok := tokenNames[id]
+	tokenNamesMu.Unlock()
+	if ok {
+		return name
+	}
+	var card struct {
+		Name string `json:"name"`
+	}
+	data, err := fetchURL(fmt.Sprintf("%s/cards/%s", scryfallAPIBase, id))
+	if err == nil {
+		err = json.Unmarshal(data, &card)
+	}
+	if err != nil || card.Name == "" {
+		log.Printf("error looking up the name of token %s: %v", id, err)
+		return "Token"
+	}
+	tokenNamesMu.Lock()
+	tokenNames[id] = card.Name
+	tokenNamesMu.Unlock()
+	return card.Name
+}
+
+// findCard looks for a card the player can see: anything on the board, in
+// their own hand, or in anyone's graveyard, exile or command zone.
+func (r *Room) findCard(username string, cardID string) (Card, bool) {
+	if card, ok := r.Cards[cardID]; ok {
+		return card.Card, true
+	}
+	for _, card := range r.Hands[username] {
+		if card.ID == cardID {
+			return card, true
+		}
+	}
+	for owner, zones := range r.Zones {
+		for zone, cards := range zones {
+			if zone == ZoneExileFaceDown && owner != username {
+				continue
+			}
+			for _, card := range cards {
+				if card.ID == cardID {
+					return card, true
+				}
+			}
+		}
+	}
+	return Card{}, false
+}
+
+// spawnTokens puts count copies of the tokens a card creates onto the board,
+// owned by the player who created them. If tokenID is empty, every kind of
+// token the card makes is created.
+func (r *Room) spawnTokens(username string, cardID string, tokenID string, count int, x, y float64) ([]*BoardCard, error) {
+	source, ok := r.findCard(username, cardID)
+	if !ok {
+		return nil, errors.New("card not found")
+	}
+	if count < 1 {
+		count = 1
+	}
+	if count > maxTokenCopies {
+		return nil, fmt.Errorf("cannot create more than %d tokens at once", maxTokenCopies)
+	}
+	var refs []TokenRef
+	for _, ref := range source.Tokens {
+		if tokenID == "" || ref.ID == tokenID {
+			refs = append(refs, ref)
+		}
+	}
+	if len(refs) == 0 {
+		return nil, errors.New("card does not create that token")
+	}
+
+	var tokens []*BoardCard
+	for _, ref := range refs {
+		for i := 0; i < count; i++ {
+			id, err := newCardID()
+			if err != nil {
+				return nil, err
+			}
+			offset := float64(len(tokens)) * 10
+			token := &BoardCard{
+				Card: Card{
+					ID:       id,
+					Name:     ref.Name,
+					ImageURL: ref.ImageURL,
+					UID:      ref.ID,
+					NumFaces: 2,
+					Token:    true,
+				},
+				X:          x + offset,
+				Y:          y + offset,
+				Owner:      username,
+				Controller: username,
+			}
+			r.Cards[token.ID] = token
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens, nil
+}
@@ -0,0 +1,201 @@
+package ws
+
+import "encoding/json"
+
+// Steps of a turn, in order.
+const (
+	StepUntap            = "untap"
+	StepUpkeep           = "upkeep"
+	StepDraw             = "draw"
+	StepMain1            = "main1"
+	StepBeginCombat      = "beginCombat"
+	StepDeclareAttackers = "declareAttackers"
+	StepDeclareBlockers  = "declareBlockers"
+	StepCombatDamage     = "combatDamage"
+	StepEndCombat        = "endCombat"
+	StepMain2            = "main2"
+	StepEnd              = "end"
+	StepCleanup          = "cleanup"
+)
+
+var turnSteps = []string{
+	StepUntap, StepUpkeep, StepDraw,
+	StepMain1,
+	StepBeginCombat, StepDeclareAttackers, StepDeclareBlockers, StepCombatDamage, StepEndCombat,
+	StepMain2,
+	StepEnd, StepCleanup,
+}
+
+// phaseOf returns the phase a step belongs to.
+func phaseOf(step string) string {
+	switch step {
+	case StepUntap, StepUpkeep, StepDraw:
+		return "beginning"
+	case StepMain1:
+		return "precombatMain"
+	case StepBeginCombat, StepDeclareAttackers, StepDeclareBlockers, StepCombatDamage, StepEndCombat:
+		return "combat"
+	case StepMain2:
+		return "postcombatMain"
+	case StepEnd, StepCleanup:
+		return "ending"
+	}
+	return ""
+}
+
+func isStep(step string) bool {
+	for _, s := range turnSteps {
+		if s == step {
+			return true
+		}
+	}
+	return false
+}
+
+// TurnOptions are a player's choices for what the server does for them at
+// the start of their turn.
+type TurnOptions struct {
+	AutoUntap bool `json:"autoUntap"`
+	AutoDraw  bool `json:"autoDraw"`
+	// AutoYield lists the steps in which the player passes priority
+	// automatically when the stack is empty.
+	AutoYield []string `json:"autoYield,omitempty"`
+}
+
+// turnEvents is what happened on the way to a step, to be announced once the
+// room is unlocked.
+type turnEvents struct {
+	NewTurn       bool
+	Untapped      bool
+	CombatEnded   bool
+	ArrowsCleared []string
+	Drew          *Card
+	Eliminations  []Elimination
+}
+
+// advanceStep moves to the next step of the turn, or to the next player's
+// turn after cleanup. A turn that has not been stepped through yet starts at
+// its untap step. The caller must hold r.mu.
+func (r *Room) advanceStep() turnEvents {
+	if r.Step == "" && r.Turn != "" {
+		if r.TurnNumber == 0 {
+			r.TurnNumber = 1
+		}
+		return r.enterStep(StepUntap)
+	}
+	for i, step := range turnSteps {
+		if step == r.Step && i+1 < len(turnSteps) {
+			return r.enterStep(turnSteps[i+1])
+		}
+	}
+	return r.nextTurn()
+}
+
+// nextTurn starts the next player's turn at its untap step. The caller must
+// hold r.mu.
+func (r *Room) nextTurn() turnEvents {
+	r.Turn = getNextTurn(r.PlayerPositions, r.Eliminated, r.Turn)
+	r.TurnNumber++
+	r.clearDamage()
+	cleared := r.clearTurnArrows()
+	events := r.enterStep(StepUntap)
+	events.NewTurn = true
+	events.ArrowsCleared = cleared
+	return events
+}
+
+// enterStep moves to a step and carries out what the active player has asked
+// the server to do in it. An automatic untap moves straight on to upkeep.
+// The caller must hold r.mu.
+func (r *Room) enterStep(step string) turnEvents {
+	r.Step = step
+	r.Hold = ""
+	r.resetPriority(r.Turn)
+	var events turnEvents
+	if phaseOf(step) != "combat" && len(r.Combat) > 0 {
+		r.endCombat()
+		events.CombatEnded = true
+	}
+	options := r.TurnOptions[r.Turn]
+	switch step {
+	case StepUntap:
+		if options.AutoUntap {
+			r.untapAll(r.Turn)
+			next := r.enterStep(StepUpkeep)
+			next.Untapped = true
+			return next
+		}
+	case StepCleanup:
+		r.clearDamage()
+	case StepDraw:
+		if options.AutoDraw {
+			card, err := r.drawCard(r.Turn)
+			if err == errEmptyLibrary && r.eliminate(r.Turn, LossEmptyLibrary) {
+				events.Eliminations = append(events.Eliminations, Elimination{Player: r.Turn, Reason: LossEmptyLibrary})
+			} else if err == nil {
+				events.Drew = &card
+			}
+		}
+	}
+	return events
+}
+
+func (r *Room) untapAll(username string) {
+	for _, card := range r.Cards {
+		if card.controlledBy() == username {
+			card.Tapped = false
+		}
+	}
+}
+
+func (r *Room) turnState() map[string]interface{} {
+	return map[string]interface{}{
+		"type":       "TURN_STATE",
+		"turn":       r.Turn,
+		"turnNumber": r.TurnNumber,
+		"phase":      phaseOf(r.Step),
+		"step":       r.Step,
+		"priority":   r.Priority,
+	}
+}
+
+// announceTurn broadcasts what happened on the way to the current step and
+// then the turn state itself.
+func (r *Room) announceTurn(events turnEvents) {
+	r.mu.Lock()
+	active := r.Turn
+	state := r.turnState()
+	combat := r.combatState()
+	r.mu.Unlock()
+	if events.NewTurn {
+		data, _ := json.Marshal(map[string]interface{}{
+			"type": "TURN_PASSED",
+			"turn": active,
+		})
+		r.BroadcastSafe(data)
+	}
+	if events.Untapped {
+		data, _ := json.Marshal(map[string]interface{}{
+			"type":   "UNTAPPED_ALL",
+			"player": active,
+		})
+		r.BroadcastSafe(data)
+	}
+	if events.Drew != nil {
+		r.announceDraw(active, *events.Drew)
+	}
+	if len(events.ArrowsCleared) > 0 {
+		data, _ := json.Marshal(map[string]interface{}{
+			"type": "ARROWS_DELETED",
+			"ids":  events.ArrowsCleared,
+		})
+		r.BroadcastSafe(data)
+	}
+	if events.CombatEnded {
+		data, _ := json.Marshal(combat)
+		r.BroadcastSafe(data)
+	}
+	r.announceEliminations(events.Eliminations)
+	data, _ := json.Marshal(state)
+	r.BroadcastSafe(data)
+}
@@ -0,0 +1,157 @@
+package ws
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+const defaultUndoDepth = 10
+
+type undoEntry struct {
+	Seq    int
+	Keys   map[string]bool
+	Revert StateChange
+	// Revealed is set when the action showed the player library cards they
+	// did not know, which undoing would let them take back.
+	Revealed bool
+}
+
+func changedKeys(change StateChange) map[string]bool {
+	keys := make(map[string]bool, len(change.Set)+len(change.Removed))
+	for key := range change.Set {
+		keys[key] = true
+	}
+	for _, key := range change.Removed {
+		keys[key] = true
+	}
+	return keys
+}
+
+// pushUndo remembers how to revert a player's action, keeping at most
+// UndoDepth actions per player.
+func (r *Room) pushUndo(username string, event *GameEvent, revert StateChange) {
+	if r.UndoDepth <= 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	history := append(r.undoHistory[username], undoEntry{
+		Seq:      event.Seq,
+		Keys:     changedKeys(event.Change),
+		Revert:   revert,
+		Revealed: revealsLibrary(event.Change, revert, username),
+	})
+	if len(history) > r.UndoDepth {
+		history = history[len(history)-r.UndoDepth:]
+	}
+	r.undoHistory[username] = history
+}
+
+// revealsLibrary reports whether a change showed the viewer a library card
+// they did not know before: by taking it out of the library, or by making it
+// known where it is.
+func revealsLibrary(change StateChange, revert StateChange, viewer string) bool {
+	for key, value := range change.Set {
+		if !strings.HasPrefix(key, "decks/") {
+			continue
+		}
+		var beforeEntry, afterEntry libraryEntry
+		if json.Unmarshal(revert.Set[key], &beforeEntry) != nil || json.Unmarshal(value, &afterEntry) != nil {
+			continue
+		}
+		before, after := beforeEntry.deck(nil), afterEntry.deck(nil)
+		position := make(map[string]int, len(after.Cards))
+		for i, card := range after.Cards {
+			position[card.ID] = i
+		}
+		for i, card := range before.Cards {
+			if before.visibleTo(i, viewer) {
+				continue
+			}
+			j, stayed := position[card.ID]
+			if !stayed || after.visibleTo(j, viewer) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// undo reverts the player's most recent action, unless another player has
+// acted on any of the same objects since. The caller must hold r.mu.
+func (r *Room) undo(username string) (StateChange, error) {
+	history := r.undoHistory[username]
+	if len(history) == 0 {
+		return StateChange{}, errors.New("nothing to undo")
+	}
+	last := history[len(history)-1]
+	for key := range last.Keys {
+		if strings.HasPrefix(key, "diceRolls/") || strings.HasPrefix(key, "shuffles/") || strings.HasPrefix(key, "seeds/") {
+			return StateChange{}, errors.New("random results cannot be undone")
+		}
+	}
+	if last.Revealed {
+		return StateChange{}, errors.New("actions that showed you library cards cannot be undone")
+	}
+	for _, event := range r.Events {
+		if event.Seq <= last.Seq || event.Actor == username {
+			continue
+		}
+		for key := range changedKeys(event.Change) {
+			if last.Keys[key] {
+				return StateChange{}, errors.New("another player has acted on the same objects since")
+			}
+		}
+	}
+
+	entries, err := r.liveSnapshot().entries()
+	if err != nil {
+		return StateChange{}, err
+	}
+	last.Revert.applyTo(entries)
+	snapshot, err := snapshotFromEntries(r.ID, entries)
+	if err != nil {
+		return StateChange{}, err
+	}
+	snapshot.copyPrivate(r.liveSnapshot())
+	r.restore(snapshot)
+	r.undoHistory[username] = history[:len(history)-1]
+	return last.Revert, nil
+}
+
+// changeFor redacts a change down to what the viewer is allowed to see:
+// their own cards, the cards revealed to them, and everyone's public objects.
+// Libraries are sent whole, as the viewer sees them now, rather than as the
+// entries the event log splits them into. The caller must hold r.mu.
+func (r *Room) changeFor(change StateChange, viewer string) StateChange {
+	view := StateChange{Set: make(map[string]json.RawMessage, len(change.Set))}
+	libraries := make(map[string]bool)
+	for key, value := range change.Set {
+		prefix, name, _ := strings.Cut(key, "/")
+		if prefix == "decks" || prefix == "library" {
+			owner, _, _ := strings.Cut(name, "/")
+			libraries[owner] = true
+			continue
+		}
+		view.Set[key] = redactEntry(key, value, viewer)
+	}
+	for _, key := range change.Removed {
+		if libraryKey(key) {
+			owner, _, _ := strings.Cut(strings.TrimPrefix(key, "library/"), "/")
+			libraries[owner] = true
+			continue
+		}
+		view.Removed = append(view.Removed, key)
+	}
+	for owner := range libraries {
+		deck, ok := r.Decks[owner]
+		if !ok {
+			continue
+		}
+		if data, err := json.Marshal(deck.redactFor(viewer)); err == nil {
+			view.Set["decks/"+owner] = data
+		}
+	}
+	return view
+}
@@ -0,0 +1,166 @@
+package ws
+
+import "errors"
+
+const (
+	VisibilityPublic  = "public"
+	VisibilityOwner   = "owner"
+	VisibilityPlayers = "players"
+)
+
+// Visibility says who may see a card's face. Owners can always see their own
+// cards; with VisibilityPlayers, so can the listed players.
+type Visibility struct {
+	Mode    string   `json:"mode"`
+	Players []string `json:"players,omitempty"`
+}
+
+func (v Visibility) allows(owner string, viewer string) bool {
+	switch v.Mode {
+	case VisibilityPublic:
+		return true
+	case VisibilityPlayers:
+		if contains(v.Players, viewer) {
+			return true
+		}
+	}
+	return viewer != "" && viewer == owner
+}
+
+// zoneVisibility is how visible a card is in a zone unless it has a
+// visibility of its own.
+func zoneVisibility(zone string) Visibility {
+	if isHiddenZone(zone) {
+		return Visibility{Mode: VisibilityOwner}
+	}
+	return Visibility{Mode: VisibilityPublic}
+}
+
+func cardVisibleTo(card Card, owner string, zone string, viewer string) bool {
+	if card.Visibility != nil {
+		return card.Visibility.allows(owner, viewer)
+	}
+	return zoneVisibility(zone).allows(owner, viewer)
+}
+
+// cardFor returns the card as the viewer may see it. Hidden cards keep their
+// ID, so they can still be referred to, but lose everything else.
+func cardFor(card Card, owner string, zone string, viewer string) Card {
+	if cardVisibleTo(card, owner, zone, viewer) {
+		return card
+	}
+	return Card{ID: card.ID, Hidden: true, Visibility: card.Visibility}
+}
+
+func cardsFor(cards []Card, owner string, zone string, viewer string) []Card {
+	view := make([]Card, len(cards))
+	for i, card := range cards {
+		view[i] = cardFor(card, owner, zone, viewer)
+		if view[i].Hidden && isHiddenZone(zone) {
+			// cards in hidden zones are not tracked by ID
+			view[i].ID = ""
+		}
+	}
+	return view
+}
+
+func boardCardFor(card *BoardCard, viewer string) *BoardCard {
+	if card == nil {
+		return nil
+	}
+	view := *card
+	// whoever controls a face-down permanent may look at it
+	view.Card = cardFor(card.Card, card.controlledBy(), ZoneBoard, viewer)
+	return &view
+}
+
+func (r *Room) boardCardsFor(viewer string) []*BoardCard {
+	cards := make([]*BoardCard, 0, len(r.Cards))
+	for _, card := range r.Cards {
+		cards = append(cards, boardCardFor(card, viewer))
+	}
+	return cards
+}
+
+// handsFor returns every hand as the viewer may see it: their own, and the
+// cards that have been revealed to them from other players' hands.
+func (r *Room) handsFor(viewer string) map[string][]Card {
+	hands := make(map[string][]Card, len(r.Hands))
+	for owner, hand := range r.Hands {
+		hands[owner] = cardsFor(hand, owner, ZoneHand, viewer)
+	}
+	return hands
+}
+
+// reveal widens who may see a card. With no players given it becomes public.
+func reveal(card *Card, owner string, zone string, players []string) {
+	if len(players) == 0 {
+		card.Visibility = &Visibility{Mode: VisibilityPublic}
+		return
+	}
+	visibility := card.Visibility
+	if visibility == nil {
+		base := zoneVisibility(zone)
+		visibility = &base
+	}
+	if visibility.Mode == VisibilityPublic {
+		return
+	}
+	widened := &Visibility{
+		Mode:    VisibilityPlayers,
+		Players: append([]string{}, visibility.Players...),
+	}
+	for _, player := range players {
+		if player != owner && !contains(widened.Players, player) {
+			widened.Players = append(widened.Players, player)
+		}
+	}
+	card.Visibility = widened
+}
+
+// cardIn finds a card in one of the owner's zones so it can be changed in
+// place. Library cards are not addressable; their visibility is tracked by
+// the library itself.
+func (r *Room) cardIn(owner string, zone string, cardID string) (*Card, error) {
+	var cards []Card
+	switch {
+	case zone == ZoneBoard:
+		card, ok := r.Cards[cardID]
+		if !ok {
+			return nil, errors.New("card is not on the board")
+		}
+		return &card.Card, nil
+	case zone == ZoneHand:
+		cards = r.Hands[owner]
+	case isNamedZone(zone):
+		cards = r.Zones[owner][zone]
+	default:
+		return nil, errors.New("cards in " + zone + " cannot be revealed")
+	}
+	for i := range cards {
+		if cards[i].ID == cardID {
+			return &cards[i], nil
+		}
+	}
+	return nil, errors.New("card is not in " + zone)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// setFaceDown turns a board card face down, hiding it from everyone but its
+// owner, or face up again.
+func (card *BoardCard) setFaceDown(faceDown bool) {
+	card.FaceDown = faceDown
+	if faceDown {
+		card.Visibility = &Visibility{Mode: VisibilityOwner}
+	} else {
+		card.Visibility = nil
+	}
+}
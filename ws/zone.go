@@ -0,0 +1,161 @@
+package ws
+
+import "errors"
+
+const (
+	ZoneBoard         = "board"
+	ZoneHand          = "hand"
+	ZoneLibrary       = "library"
+	ZoneGraveyard     = "graveyard"
+	ZoneExile         = "exile"
+	ZoneExileFaceDown = "exileFaceDown"
+	ZoneCommand       = "command"
+	ZoneStack         = "stack"
+)
+
+// PlayerZones holds the named zones a player owns besides their hand and
+// library, keyed by zone name. The last card of a slice is the top of the zone.
+type PlayerZones map[string][]Card
+
+var namedZones = []string{ZoneGraveyard, ZoneExile, ZoneExileFaceDown, ZoneCommand}
+
+func newPlayerZones() PlayerZones {
+	zones := make(PlayerZones, len(namedZones))
+	for _, zone := range namedZones {
+		zones[zone] = []Card{}
+	}
+	return zones
+}
+
+func isNamedZone(zone string) bool {
+	for _, z := range namedZones {
+		if z == zone {
+			return true
+		}
+	}
+	return false
+}
+
+func isHiddenZone(zone string) bool {
+	return zone == ZoneHand || zone == ZoneLibrary || zone == ZoneExileFaceDown
+}
+
+// zonesFor returns every player's named zones as the viewer is allowed to see
+// them: face-down exiled cards are only shown to their owner, unless revealed.
+func (r *Room) zonesFor(viewer string) map[string]PlayerZones {
+	view := make(map[string]PlayerZones, len(r.Zones))
+	for owner, zones := range r.Zones {
+		playerView := make(PlayerZones, len(zones))
+		for zone, cards := range zones {
+			playerView[zone] = cardsFor(cards, owner, zone, viewer)
+		}
+		view[owner] = playerView
+	}
+	return view
+}
+
+func (r *Room) deckSize(owner string) int {
+	deck, ok := r.Decks[owner]
+	if !ok {
+		return 0
+	}
+	return len(deck.Cards)
+}
+
+func (r *Room) commanderTax() map[string]int {
+	tax := make(map[string]int, len(r.CommanderCasts))
+	for id, casts := range r.CommanderCasts {
+		tax[id] = 2 * casts
+	}
+	return tax
+}
+
+// takeCard removes a card from one of the owner's zones. Board cards are
+// looked up by ID alone since the battlefield is shared. Whatever was revealed
+// about the card stays behind with the zone.
+func (r *Room) takeCard(owner string, zone string, cardID string) (Card, error) {
+	card, err := r.removeCard(owner, zone, cardID)
+	card.Visibility = nil
+	return card, err
+}
+
+func (r *Room) removeCard(owner string, zone string, cardID string) (Card, error) {
+	switch {
+	case zone == ZoneBoard:
+		card, ok := r.Cards[cardID]
+		if !ok {
+			return Card{}, errors.New("card is not on the board")
+		}
+		r.removeFromBoard(cardID)
+		return card.Card, nil
+	case zone == ZoneHand:
+		card, ok := r.takeFromHand(owner, cardID)
+		if !ok {
+			return Card{}, errors.New("card is not in hand")
+		}
+		return card, nil
+	case zone == ZoneLibrary:
+		deck, ok := r.Decks[owner]
+		if !ok {
+			return Card{}, errors.New("player has no library")
+		}
+		card, ok := deck.take(cardID)
+		if !ok {
+			return Card{}, errors.New("card is not in library")
+		}
+		return card, nil
+	case isNamedZone(zone):
+		zones, ok := r.Zones[owner]
+		if !ok {
+			return Card{}, errors.New("player has no zones")
+		}
+		cards := zones[zone]
+		for i, card := range cards {
+			if card.ID == cardID {
+				zones[zone] = append(cards[:i:i], cards[i+1:]...)
+				return card, nil
+			}
+		}
+		return Card{}, errors.New("card is not in " + zone)
+	}
+	return Card{}, errors.New("unknown zone: " + zone)
+}
+
+// putCard places a card into one of the owner's zones. Cards put into the
+// library go on top, known as well as the zone they came from; cards put onto
+// the board are created at x, y.
+func (r *Room) putCard(owner string, source string, zone string, card Card, x, y float64) (*BoardCard, error) {
+	switch {
+	case zone == ZoneBoard:
+		boardCard := &BoardCard{
+			Card:       card,
+			X:          x,
+			Y:          y,
+			Owner:      owner,
+			Controller: owner,
+		}
+		r.Cards[card.ID] = boardCard
+		return boardCard, nil
+	case card.Token:
+		// tokens cease to exist once they leave the battlefield
+		return nil, nil
+	case zone == ZoneHand:
+		r.addToHand(owner, card)
+		return nil, nil
+	case zone == ZoneLibrary:
+		deck, ok := r.Decks[owner]
+		if !ok {
+			return nil, errors.New("player has no library")
+		}
+		deck.putOnTop(card, knownFrom(source))
+		return nil, nil
+	case isNamedZone(zone):
+		zones, ok := r.Zones[owner]
+		if !ok {
+			return nil, errors.New("player has no zones")
+		}
+		zones[zone] = append(zones[zone], card)
+		return nil, nil
+	}
+	return nil, errors.New("unknown zone: " + zone)
+}